@@ -17,42 +17,24 @@ long get_linux_clock_ticks() {
 */
 import "C"
 
-func getCPUStatsLinux() CPUStats {
-	// Versuche zuerst /host/proc/stat für Container-Umgebungen
-	data, err := os.ReadFile("/host/proc/stat")
+// readProcFile reads a file below /proc, preferring the host's /proc mounted
+// at /host/proc in container environments.
+func readProcFile(name string) ([]byte, error) {
+	// Versuche zuerst /host/proc für Container-Umgebungen
+	data, err := os.ReadFile("/host/proc/" + name)
 	if err != nil {
-		// Fallback auf Standard /proc/stat
-		data, err = os.ReadFile("/proc/stat")
-		if err != nil {
-			return CPUStats{}
-		}
-	}
-
-	lines := bytes.Split(data, []byte("\n"))
-	if len(lines) == 0 {
-		return CPUStats{}
+		// Fallback auf Standard /proc
+		return os.ReadFile("/proc/" + name)
 	}
+	return data, nil
+}
 
-	// Parse first line: "cpu  user nice system idle iowait irq softirq steal guest guest_nice"
-	fields := bytes.Fields(lines[0])
-	if len(fields) < 8 || string(fields[0]) != "cpu" {
+func getCPUStatsLinux() CPUStats {
+	data, err := readProcFile("stat")
+	if err != nil {
 		return CPUStats{}
 	}
 
-	var values [10]uint64
-	var totalTicks uint64
-
-	// Parse numeric values starting from field 1 (skip "cpu")
-	for i := 1; i < len(fields) && i < 11; i++ {
-		if val, err := strconv.ParseUint(string(fields[i]), 10, 64); err == nil {
-			values[i-1] = val
-			totalTicks += val
-		}
-	}
-
-	// Idle time is field 4 (index 3 in our values array)
-	idleTicks := values[3]
-
 	// Get actual tick rate from Linux kernel
 	ticksPerSecond := int(C.get_linux_clock_ticks())
 	if ticksPerSecond <= 0 {
@@ -63,10 +45,47 @@ func getCPUStatsLinux() CPUStats {
 	const nanosPerSecond = 1000000000
 	nanosPerTick := nanosPerSecond / uint64(ticksPerSecond)
 
-	return CPUStats{
-		IdleTime:  idleTicks * nanosPerTick,
-		TotalTime: totalTicks * nanosPerTick,
+	var stats CPUStats
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		// "cpu  user nice system idle iowait irq softirq steal guest guest_nice"
+		// for the aggregate, followed by one "cpuN ..." line per core
+		fields := bytes.Fields(line)
+		if len(fields) < 8 || !bytes.HasPrefix(fields[0], []byte("cpu")) {
+			continue
+		}
+
+		var values [10]uint64
+		// Parse numeric values starting from field 1 (skip "cpu")
+		for i := 1; i < len(fields) && i < 11; i++ {
+			if val, err := strconv.ParseUint(string(fields[i]), 10, 64); err == nil {
+				values[i-1] = val * nanosPerTick
+			}
+		}
+
+		times := CPUTimes{
+			Name:      string(fields[0]),
+			User:      values[0],
+			Nice:      values[1],
+			System:    values[2],
+			Idle:      values[3],
+			IOWait:    values[4],
+			IRQ:       values[5],
+			SoftIRQ:   values[6],
+			Steal:     values[7],
+			Guest:     values[8],
+			GuestNice: values[9],
+		}
+
+		if times.Name == "cpu" {
+			stats.IdleTime = times.Idle
+			stats.TotalTime = times.Total()
+			stats.Modes = &times
+		} else {
+			stats.Cores = append(stats.Cores, times)
+		}
 	}
+
+	return stats
 }
 
 // Stub functions for other platforms
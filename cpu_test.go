@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestCPUModePercents(t *testing.T) {
+	prev := CPUTimes{User: 1000, System: 500, Idle: 8000, IOWait: 300, Guest: 200}
+
+	tests := []struct {
+		name string
+		curr CPUTimes
+		want CPUModes
+		ok   bool
+	}{
+		{
+			name: "all modes",
+			curr: CPUTimes{User: 1100, System: 550, Idle: 8800, IOWait: 350, Guest: 200},
+			want: CPUModes{User: 10, System: 5, Idle: 80, IOWait: 5},
+			ok:   true,
+		},
+		{
+			// Guest time is part of User and must not count twice
+			name: "guest",
+			curr: CPUTimes{User: 1200, System: 500, Idle: 8800, IOWait: 300, Guest: 300},
+			want: CPUModes{User: 20, Idle: 80, Guest: 10},
+			ok:   true,
+		},
+		{
+			// Some kernels decrement iowait between two reads
+			name: "iowait backwards",
+			curr: CPUTimes{User: 1500, System: 500, Idle: 8800, IOWait: 250, Guest: 200},
+			want: CPUModes{User: 40, Idle: 64},
+			ok:   true,
+		},
+		{
+			name: "no time passed",
+			curr: prev,
+		},
+		{
+			// Core went offline and online again with fresh counters
+			name: "counter reset",
+			curr: CPUTimes{User: 10, System: 5, Idle: 80},
+		},
+	}
+	for _, tt := range tests {
+		got, ok := cpuModePercents(prev, tt.curr)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: got %+v, %t, want %+v, %t", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// retryPolicy controls how failed deliveries are retried.
+type retryPolicy struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts gives up on a payload after this many attempts. 0 retries
+	// forever when a spool is available and tries only once without.
+	MaxAttempts int
+}
+
+// httpStatusError is returned when a server answers with an unexpected
+// status code.
+type httpStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// permanent reports whether retrying the same request can never succeed.
+func (e *httpStatusError) permanent() bool {
+	return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusRequestEntityTooLarge
+}
+
+// checkHTTPResponse returns an httpStatusError for non-2xx responses and
+// drains the body otherwise so the connection can be reused.
+func checkHTTPResponse(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return &httpStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// permanentDeliveryError marks errors that retrying cannot fix, e.g.
+// documents rejected by the server.
+type permanentDeliveryError struct {
+	err error
+}
+
+func (e *permanentDeliveryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentDeliveryError) Unwrap() error {
+	return e.err
+}
+
+// partialDeliveryError is returned when only some records of a request were
+// stored. Only the remaining records are retried.
+type partialDeliveryError struct {
+	remaining [][]byte
+	err       error
+}
+
+func (e *partialDeliveryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *partialDeliveryError) Unwrap() error {
+	return e.err
+}
+
+// remainingRecords returns the records that still need to be delivered after
+// err, which are all records unless the error reports a partial delivery.
+func remainingRecords(records [][]byte, err error) [][]byte {
+	var partialErr *partialDeliveryError
+	if errors.As(err, &partialErr) {
+		return partialErr.remaining
+	}
+	return records
+}
+
+func isPermanentDeliveryError(err error) bool {
+	var permanentErr *permanentDeliveryError
+	if errors.As(err, &permanentErr) {
+		return true
+	}
+	var statusErr *httpStatusError
+	return errors.As(err, &statusErr) && statusErr.permanent()
+}
+
+// deliveryQueue hands records to a delivery function. With a spool, records
+// that cannot be delivered are buffered on disk and replayed in order with
+// exponential backoff; without a spool, delivery is retried in place.
+// Records are stored one per line and therefore must not contain newlines.
+type deliveryQueue struct {
+	name    string
+	deliver func(records [][]byte) error
+	spool   *spool
+	policy  retryPolicy
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+func newDeliveryQueue(name string, deliver func(records [][]byte) error, sp *spool, policy retryPolicy) *deliveryQueue {
+	if policy.MinBackoff <= 0 {
+		policy.MinBackoff = 1 * time.Second
+	}
+	if policy.MaxBackoff < policy.MinBackoff {
+		policy.MaxBackoff = policy.MinBackoff
+	}
+
+	q := &deliveryQueue{
+		name:    name,
+		deliver: deliver,
+		spool:   sp,
+		policy:  policy,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	if q.spool != nil {
+		go q.replay()
+		q.notify()
+	}
+
+	return q
+}
+
+// Submit delivers the records as one request.
+func (q *deliveryQueue) Submit(records ...[]byte) error {
+	if q.spool == nil {
+		return q.deliverWithRetry(records)
+	}
+
+	// Keep ordering: as long as older records are waiting, queue behind them
+	if q.spool.Pending() {
+		return q.buffer(records...)
+	}
+
+	if err := q.deliver(records); err != nil {
+		if isPermanentDeliveryError(err) {
+			return fmt.Errorf("Senden an %s: %w", q.name, err)
+		}
+		logError("Fehler beim Senden an %s, Events werden im Spool abgelegt: %v", q.name, err)
+		return q.buffer(remainingRecords(records, err)...)
+	}
+	return nil
+}
+
+func (q *deliveryQueue) Close() error {
+	close(q.done)
+	if q.spool != nil {
+		return q.spool.Close()
+	}
+	return nil
+}
+
+func (q *deliveryQueue) deliverWithRetry(records [][]byte) error {
+	backoff := q.policy.MinBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := q.deliver(records)
+		if err == nil || isPermanentDeliveryError(err) || attempt >= max(q.policy.MaxAttempts, 1) {
+			if err != nil {
+				return fmt.Errorf("Senden an %s: %w", q.name, err)
+			}
+			return nil
+		}
+
+		logError("Fehler beim Senden an %s, nächster Versuch in %s: %v", q.name, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-q.done:
+			return err
+		}
+		backoff = min(backoff*2, q.policy.MaxBackoff)
+		records = remainingRecords(records, err)
+	}
+}
+
+func (q *deliveryQueue) buffer(records ...[]byte) error {
+	if err := q.spool.Append(records...); err != nil {
+		return fmt.Errorf("Schreiben in den Spool: %w", err)
+	}
+	q.notify()
+	return nil
+}
+
+func (q *deliveryQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// replay drains the spool oldest segment first until it is empty and then
+// waits for new records to be buffered.
+func (q *deliveryQueue) replay() {
+	backoff := q.policy.MinBackoff
+	attempts := 0
+
+	// Records of the current segment left after a partial delivery
+	var remaining [][]byte
+	var remainingSeq uint64
+
+	for {
+		segment, data, ok, err := q.spool.Next()
+		if err != nil {
+			logError("Fehler beim Lesen des Spools: %v", err)
+		}
+		if !ok {
+			select {
+			case <-q.wake:
+				continue
+			case <-q.done:
+				return
+			}
+		}
+
+		if len(data) > 0 {
+			records := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+			if remaining != nil && remainingSeq == segment.seq {
+				records = remaining
+			}
+			err = q.deliver(records)
+			attempts++
+			remaining, remainingSeq = nil, 0
+			if err != nil {
+				remaining, remainingSeq = remainingRecords(records, err), segment.seq
+			}
+
+			giveUp := isPermanentDeliveryError(err) || (q.policy.MaxAttempts > 0 && attempts >= q.policy.MaxAttempts)
+			if err != nil && !giveUp {
+				logError("Fehler beim erneuten Senden an %s, nächster Versuch in %s: %v", q.name, backoff, err)
+				select {
+				case <-time.After(backoff):
+				case <-q.done:
+					return
+				}
+				backoff = min(backoff*2, q.policy.MaxBackoff)
+				continue
+			}
+			if err != nil {
+				logError("Spool-Segment für %s verworfen: %v", q.name, err)
+			}
+		}
+
+		if err := q.spool.Remove(segment); err != nil {
+			logError("Fehler beim Entfernen des Spool-Segments: %v", err)
+		}
+		backoff = q.policy.MinBackoff
+		attempts = 0
+	}
+}
+
+// batcher collects records and submits them to a deliveryQueue as one
+// request once the batch is full or the flush interval has elapsed.
+type batcher struct {
+	queue    *deliveryQueue
+	size     int           // flush after this many records
+	maxBytes int           // flush before the request grows beyond this size, 0 for no limit
+	interval time.Duration // flush at least this often, 0 flushes every record
+
+	mu         sync.Mutex
+	batch      [][]byte
+	batchBytes int
+
+	flushMu sync.Mutex // serializes flushes to keep record order
+
+	done chan struct{}
+}
+
+func newBatcher(queue *deliveryQueue, size, maxBytes int, interval time.Duration) *batcher {
+	if size <= 0 {
+		size = 1
+	}
+
+	b := &batcher{
+		queue:    queue,
+		size:     size,
+		maxBytes: maxBytes,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+
+	if b.interval > 0 {
+		go b.flushPeriodically()
+	}
+
+	return b
+}
+
+func (b *batcher) Add(record []byte) error {
+	b.mu.Lock()
+	b.batch = append(b.batch, record)
+	b.batchBytes += len(record) + 1
+	full := b.interval == 0 || len(b.batch) >= b.size || (b.maxBytes > 0 && b.batchBytes >= b.maxBytes)
+	b.mu.Unlock()
+
+	if full {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Flush submits all collected records as one request.
+func (b *batcher) Flush() error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.batch
+	b.batch = nil
+	b.batchBytes = 0
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return b.queue.Submit(batch...)
+}
+
+// Close flushes the remaining records and stops the queue.
+func (b *batcher) Close() error {
+	err := b.Flush()
+	close(b.done)
+	b.queue.Close()
+	return err
+}
+
+func (b *batcher) flushPeriodically() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Flush(); err != nil {
+				logError("Fehler beim Senden an %s: %v", b.queue.name, err)
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
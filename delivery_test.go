@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingServer is an HTTP stand-in that stores the request bodies and
+// answers with a configurable status code.
+type recordingServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	status int
+	bodies []string
+}
+
+func newRecordingServer(t *testing.T) *recordingServer {
+	s := &recordingServer{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		status := s.status
+		if status < 300 {
+			s.bodies = append(s.bodies, string(body))
+		}
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *recordingServer) setStatus(status int) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+func (s *recordingServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+// waitFor polls cond until it holds or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeliveryQueueReplaysInOrderAfterRecovery(t *testing.T) {
+	server := newRecordingServer(t)
+	server.setStatus(http.StatusServiceUnavailable)
+
+	sp, err := openSpool(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &seqSender{opts: seqOptions{URL: server.URL}, client: server.Client()}
+	queue := newDeliveryQueue("Seq", func(records [][]byte) error {
+		return sender.sendToSeq(bytes.Join(records, []byte("\n")))
+	}, sp, retryPolicy{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	defer queue.Close()
+
+	for _, event := range []string{"1", "2", "3"} {
+		if err := queue.Submit([]byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !sp.Pending() {
+		t.Fatal("events not spooled while server is down")
+	}
+
+	server.setStatus(http.StatusCreated)
+	// Submitted while older events are still spooled, must queue behind them
+	if err := queue.Submit([]byte("4")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return !sp.Pending() })
+	// The spooled events are replayed as one request per segment
+	if got := strings.Join(server.received(), "\n"); got != "1\n2\n3\n4" {
+		t.Errorf("received %q, want 1 to 4 in order", got)
+	}
+}
+
+func TestDeliveryQueueDoesNotSpoolPermanentFailures(t *testing.T) {
+	sp, err := openSpool(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := newDeliveryQueue("test", func(records [][]byte) error {
+		return &httpStatusError{StatusCode: http.StatusBadRequest}
+	}, sp, retryPolicy{})
+	defer queue.Close()
+
+	if err := queue.Submit([]byte("invalid")); err == nil {
+		t.Error("no error for rejected event")
+	}
+	if sp.Pending() {
+		t.Error("rejected event was spooled")
+	}
+}
+
+func TestDeliveryQueueBackoff(t *testing.T) {
+	var attempts []time.Time
+	queue := newDeliveryQueue("test", func(records [][]byte) error {
+		attempts = append(attempts, time.Now())
+		return errors.New("unavailable")
+	}, nil, retryPolicy{
+		MinBackoff:  20 * time.Millisecond,
+		MaxBackoff:  50 * time.Millisecond,
+		MaxAttempts: 5,
+	})
+	defer queue.Close()
+
+	if err := queue.Submit([]byte("event")); err == nil {
+		t.Fatal("no error after the last attempt")
+	}
+	if len(attempts) != 5 {
+		t.Fatalf("got %d attempts, want 5", len(attempts))
+	}
+
+	// Doubling from MinBackoff, capped at MaxBackoff
+	want := []time.Duration{20, 40, 50, 50}
+	for i, min := range want {
+		if gap := attempts[i+1].Sub(attempts[i]); gap < min*time.Millisecond {
+			t.Errorf("backoff before attempt %d = %s, want at least %dms", i+2, gap, min)
+		}
+	}
+}
+
+func TestDeliveryQueueStopsRetryingOnPermanentError(t *testing.T) {
+	attempts := 0
+	queue := newDeliveryQueue("test", func(records [][]byte) error {
+		attempts++
+		return &httpStatusError{StatusCode: http.StatusBadRequest}
+	}, nil, retryPolicy{MinBackoff: time.Millisecond, MaxAttempts: 5})
+	defer queue.Close()
+
+	if err := queue.Submit([]byte("event")); err == nil {
+		t.Fatal("no error for permanent failure")
+	}
+	if attempts != 1 {
+		t.Errorf("got %d attempts, want 1", attempts)
+	}
+}
+
+// batchRecorder collects the batches submitted by a batcher.
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches []string
+}
+
+func (r *batchRecorder) deliver(records [][]byte) error {
+	var parts []string
+	for _, record := range records {
+		parts = append(parts, string(record))
+	}
+	r.mu.Lock()
+	r.batches = append(r.batches, strings.Join(parts, ","))
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *batchRecorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.batches...)
+}
+
+func TestBatcherFlushesWhenFull(t *testing.T) {
+	var recorder batchRecorder
+	b := newBatcher(newDeliveryQueue("test", recorder.deliver, nil, retryPolicy{}), 3, 0, time.Hour)
+	defer b.Close()
+
+	for _, record := range []string{"a", "b", "c", "d"} {
+		if err := b.Add([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := recorder.get(); len(got) != 1 || got[0] != "a,b,c" {
+		t.Errorf("batches = %q, want [a,b,c]", got)
+	}
+}
+
+func TestBatcherFlushesAtMaxBytes(t *testing.T) {
+	var recorder batchRecorder
+	b := newBatcher(newDeliveryQueue("test", recorder.deliver, nil, retryPolicy{}), 100, 8, time.Hour)
+	defer b.Close()
+
+	// Each record counts with its newline, the second one reaches 8 bytes
+	for _, record := range []string{"abc", "def", "ghi"} {
+		if err := b.Add([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := recorder.get(); len(got) != 1 || got[0] != "abc,def" {
+		t.Errorf("batches = %q, want [abc,def]", got)
+	}
+}
+
+func TestBatcherFlushesAfterInterval(t *testing.T) {
+	var recorder batchRecorder
+	b := newBatcher(newDeliveryQueue("test", recorder.deliver, nil, retryPolicy{}), 100, 0, 20*time.Millisecond)
+	defer b.Close()
+
+	for _, record := range []string{"a", "b"} {
+		if err := b.Add([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := recorder.get(); len(got) != 0 {
+		t.Fatalf("flushed before the interval: %q", got)
+	}
+
+	waitFor(t, time.Second, func() bool { return len(recorder.get()) == 1 })
+	if got := recorder.get(); got[0] != "a,b" {
+		t.Errorf("batches = %q, want [a,b]", got)
+	}
+}
+
+func TestBatcherCloseFlushesRemainder(t *testing.T) {
+	var recorder batchRecorder
+	b := newBatcher(newDeliveryQueue("test", recorder.deliver, nil, retryPolicy{}), 100, 0, time.Hour)
+
+	if err := b.Add([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := recorder.get(); len(got) != 1 || got[0] != "a" {
+		t.Errorf("batches = %q, want [a]", got)
+	}
+}
+
+func TestDeliveryQueueReplaysOnlyRemainingRecords(t *testing.T) {
+	sp, err := openSpool(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var calls []string
+	queue := newDeliveryQueue("test", func(records [][]byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, string(bytes.Join(records, []byte(","))))
+		switch len(calls) {
+		case 1:
+			return errors.New("unavailable")
+		case 2:
+			return &partialDeliveryError{remaining: records[1:], err: errors.New("partly stored")}
+		}
+		return nil
+	}, sp, retryPolicy{MinBackoff: time.Millisecond})
+	defer queue.Close()
+
+	if err := queue.Submit([]byte("a"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, func() bool { return !sp.Pending() })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(calls, " "); got != "a,b a,b b" {
+		t.Errorf("deliveries %q, want a,b a,b b", got)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// diskDiscoveryConfig enables the automatic discovery of mounted filesystems.
+// Patterns use path.Match syntax, e.g. "ext*" or "/mnt/*".
+type diskDiscoveryConfig struct {
+	Enabled            bool     `json:"enabled"`
+	IncludeFSTypes     []string `json:"include_fstypes"`
+	ExcludeFSTypes     []string `json:"exclude_fstypes"` // in addition to defaultExcludedFSTypes
+	IncludeMountpoints []string `json:"include_mountpoints"`
+	ExcludeMountpoints []string `json:"exclude_mountpoints"`
+}
+
+// defaultExcludedFSTypes are pseudo, memory and image filesystems that are
+// skipped during discovery unless explicitly included.
+var defaultExcludedFSTypes = []string{
+	"autofs", "binfmt_misc", "bpf", "cgroup", "cgroup2", "configfs", "debugfs",
+	"devfs", "devpts", "devtmpfs", "efivarfs", "fuse.gvfsd-fuse", "fuse.lxcfs",
+	"fuse.portal", "fusectl", "hugetlbfs", "mqueue", "nsfs", "nullfs", "overlay",
+	"aufs", "proc", "pstore", "ramfs", "rpc_pipefs", "securityfs", "selinuxfs",
+	"squashfs", "sysfs", "tmpfs", "tracefs",
+}
+
+// DiskUsage is the usage of a single mounted filesystem.
+type DiskUsage struct {
+	Path          string  `json:"Path"` // mountpoint or configured path
+	Device        string  `json:"Device,omitempty"`
+	FSType        string  `json:"FS_Type,omitempty"`
+	Percent       float64 `json:"Percent"`
+	FreeBytes     uint64  `json:"Free_Bytes"`
+	UsedBytes     uint64  `json:"Used_Bytes"`
+	TotalBytes    uint64  `json:"Total_Bytes"`
+	InodesPercent float64 `json:"Inodes_Percent"` // 0 on Windows
+	InodesFree    uint64  `json:"Inodes_Free"`
+	InodesTotal   uint64  `json:"Inodes_Total"`
+}
+
+// primaryDiskPath returns the disk reported as Disk_Percent and Disk_Free_GB.
+func primaryDiskPath(config *Config) string {
+	if config != nil && config.Disk != "" {
+		return config.Disk
+	}
+	if runtime.GOOS == "windows" {
+		return "C:\\"
+	}
+	return "/"
+}
+
+// getDiskUsages returns the usage of the configured and discovered
+// filesystems. Without either the primary disk is reported.
+func getDiskUsages(config *Config) []DiskUsage {
+	var paths []string
+	if config != nil {
+		paths = append(paths, config.Disks...)
+		if config.DiskDiscovery != nil && config.DiskDiscovery.Enabled {
+			paths = append(paths, discoverMountpoints(*config.DiskDiscovery)...)
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{primaryDiskPath(config)}
+	}
+
+	partitions := make(map[string]disk.PartitionStat)
+	if all, err := disk.Partitions(true); err == nil {
+		for _, p := range all {
+			partitions[p.Mountpoint] = p
+		}
+	}
+
+	var usages []DiskUsage
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		usage, err := disk.Usage(p)
+		if err != nil || seen[usage.Path] {
+			continue
+		}
+		seen[usage.Path] = true
+
+		fsType := usage.Fstype
+		partition, found := partitions[usage.Path]
+		if found && partition.Fstype != "" {
+			fsType = partition.Fstype
+		}
+
+		usages = append(usages, DiskUsage{
+			Path:          usage.Path,
+			Device:        partition.Device,
+			FSType:        fsType,
+			Percent:       usage.UsedPercent,
+			FreeBytes:     usage.Free,
+			UsedBytes:     usage.Used,
+			TotalBytes:    usage.Total,
+			InodesPercent: usage.InodesUsedPercent,
+			InodesFree:    usage.InodesFree,
+			InodesTotal:   usage.InodesTotal,
+		})
+	}
+
+	return usages
+}
+
+// discoverMountpoints lists the mountpoints of real filesystems matching the
+// discovery filters.
+func discoverMountpoints(cfg diskDiscoveryConfig) []string {
+	partitions, err := disk.Partitions(true)
+	if err != nil {
+		logError("Fehler beim Ermitteln der Dateisysteme: %v", err)
+		return nil
+	}
+	return selectMountpoints(cfg, partitions)
+}
+
+// selectMountpoints filters the mounted partitions by the discovery filters.
+// Bind mounts of the same device are reported once, under their shortest
+// mountpoint.
+func selectMountpoints(cfg diskDiscoveryConfig, partitions []disk.PartitionStat) []string {
+	byDevice := make(map[string]string)
+	for _, p := range partitions {
+		fsType := strings.ToLower(p.Fstype)
+
+		if len(cfg.IncludeFSTypes) > 0 {
+			if !matchAnyPattern(cfg.IncludeFSTypes, fsType) {
+				continue
+			}
+		} else if matchAnyPattern(defaultExcludedFSTypes, fsType) {
+			continue
+		}
+		if matchAnyPattern(cfg.ExcludeFSTypes, fsType) {
+			continue
+		}
+		if len(cfg.IncludeMountpoints) > 0 && !matchAnyPattern(cfg.IncludeMountpoints, p.Mountpoint) {
+			continue
+		}
+		if matchAnyPattern(cfg.ExcludeMountpoints, p.Mountpoint) {
+			continue
+		}
+
+		device := p.Device
+		if device == "" || device == "none" {
+			device = p.Mountpoint
+		}
+		if existing, ok := byDevice[device]; !ok || len(p.Mountpoint) < len(existing) {
+			byDevice[device] = p.Mountpoint
+		}
+	}
+
+	mountpoints := make([]string, 0, len(byDevice))
+	for _, mountpoint := range byDevice {
+		mountpoints = append(mountpoints, mountpoint)
+	}
+	sort.Strings(mountpoints)
+	return mountpoints
+}
+
+// matchAnyPattern reports whether value matches one of the glob patterns.
+func matchAnyPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
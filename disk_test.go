@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// testMounts is an excerpt of /proc/mounts on a host running containers.
+const testMounts = `sysfs /sys sysfs rw,nosuid,nodev,noexec,relatime 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+udev /dev devtmpfs rw,nosuid,relatime,size=8123456k 0 0
+devpts /dev/pts devpts rw,nosuid,noexec,relatime 0 0
+tmpfs /run tmpfs rw,nosuid,nodev,noexec,relatime 0 0
+/dev/nvme0n1p2 / ext4 rw,relatime 0 0
+cgroup2 /sys/fs/cgroup cgroup2 rw,nosuid,nodev,noexec,relatime 0 0
+/dev/nvme0n1p1 /boot/efi vfat rw,relatime 0 0
+/dev/sdb1 /srv/data xfs rw,relatime 0 0
+/dev/sdb1 /var/lib/docker/volumes/data xfs rw,relatime 0 0
+/dev/sdb1 /srv/data/export xfs rw,relatime 0 0
+overlay /var/lib/docker/overlay2/abc/merged overlay rw,relatime 0 0
+/dev/loop0 /snap/core/123 squashfs ro,nodev,relatime 0 0
+nsfs /run/docker/netns/default nsfs rw 0 0
+fuse.lxcfs /var/lib/lxcfs fuse.lxcfs rw,nosuid,nodev,relatime 0 0
+none /mnt/scratch XFS rw,relatime 0 0
+`
+
+// parseTestMounts reads partitions in /proc/mounts format.
+func parseTestMounts(t *testing.T, mounts string) []disk.PartitionStat {
+	t.Helper()
+	var partitions []disk.PartitionStat
+	scanner := bufio.NewScanner(strings.NewReader(mounts))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			t.Fatalf("malformed mount %q", scanner.Text())
+		}
+		partitions = append(partitions, disk.PartitionStat{
+			Device:     fields[0],
+			Mountpoint: fields[1],
+			Fstype:     fields[2],
+			Opts:       strings.Split(fields[3], ","),
+		})
+	}
+	return partitions
+}
+
+func TestSelectMountpoints(t *testing.T) {
+	partitions := parseTestMounts(t, testMounts)
+
+	tests := []struct {
+		name string
+		cfg  diskDiscoveryConfig
+		want []string
+	}{
+		{
+			// Pseudo filesystems are skipped, bind mounts of /dev/sdb1 are
+			// reported once and "none" devices are told apart by mountpoint
+			name: "defaults",
+			want: []string{"/", "/boot/efi", "/mnt/scratch", "/srv/data"},
+		},
+		{
+			name: "include fstypes",
+			cfg:  diskDiscoveryConfig{IncludeFSTypes: []string{"ext*", "tmpfs"}},
+			want: []string{"/", "/run"},
+		},
+		{
+			name: "exclude fstypes",
+			cfg:  diskDiscoveryConfig{ExcludeFSTypes: []string{"vfat", "xfs"}},
+			want: []string{"/"},
+		},
+		{
+			name: "include mountpoints",
+			cfg:  diskDiscoveryConfig{IncludeMountpoints: []string{"/srv/*", "/boot/*"}},
+			want: []string{"/boot/efi", "/srv/data"},
+		},
+		{
+			// The shortest remaining bind mount represents the device
+			name: "exclude mountpoints",
+			cfg:  diskDiscoveryConfig{ExcludeMountpoints: []string{"/srv/data", "/mnt/*"}},
+			want: []string{"/", "/boot/efi", "/srv/data/export"},
+		},
+	}
+	for _, tt := range tests {
+		if got := selectMountpoints(tt.cfg, partitions); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import "sort"
+
+// diskIOConfig filters the block devices reported in Disk_IO. Patterns use
+// path.Match syntax, e.g. "sd*" or "nvme*n1".
+type diskIOConfig struct {
+	IncludeDevices []string `json:"include_devices"`
+	ExcludeDevices []string `json:"exclude_devices"` // in addition to defaultExcludedDiskIODevices
+
+	// Partitions count the same I/O as their disk and are skipped by default
+	IncludePartitions bool `json:"include_partitions"`
+}
+
+// defaultExcludedDiskIODevices are loop, RAM and optical devices that are
+// skipped unless explicitly included.
+var defaultExcludedDiskIODevices = []string{"loop*", "ram*", "sr*", "fd*"}
+
+// DiskIOCounters are the cumulative I/O counters of one block device.
+type DiskIOCounters struct {
+	Reads, Writes         uint64
+	ReadBytes, WriteBytes uint64
+	ReadTime, WriteTime   uint64 // in milliseconds, Linux only
+	IOTime                uint64 // time the device was busy in milliseconds, Linux only
+}
+
+// DiskIOUsage is the I/O rate of one block device between two samples.
+type DiskIOUsage struct {
+	Device      string  `json:"Device"`
+	ReadBPS     uint64  `json:"Read_BPS"`
+	WriteBPS    uint64  `json:"Write_BPS"`
+	ReadIOPS    float64 `json:"Read_IOPS"`
+	WriteIOPS   float64 `json:"Write_IOPS"`
+	AwaitMS     float64 `json:"Await_MS"`     // average time per request, Linux only
+	UtilPercent float64 `json:"Util_Percent"` // Linux only
+}
+
+// getDiskIOStats returns the counters of all block devices passing the
+// configured filters.
+func getDiskIOStats(config *Config) map[string]DiskIOCounters {
+	var cfg diskIOConfig
+	if config != nil && config.DiskIO != nil {
+		cfg = *config.DiskIO
+	}
+	return filterDiskIOCounters(readDiskIOCounters(), cfg, isDiskPartition)
+}
+
+// filterDiskIOCounters removes partitions unless included and all devices
+// not passing the include and exclude patterns.
+func filterDiskIOCounters(counters map[string]DiskIOCounters, cfg diskIOConfig, isPartition func(string) bool) map[string]DiskIOCounters {
+	for device := range counters {
+		if !cfg.IncludePartitions && isPartition(device) {
+			delete(counters, device)
+			continue
+		}
+		if len(cfg.IncludeDevices) > 0 {
+			if !matchAnyPattern(cfg.IncludeDevices, device) {
+				delete(counters, device)
+			}
+		} else if matchAnyPattern(defaultExcludedDiskIODevices, device) {
+			delete(counters, device)
+		}
+		if matchAnyPattern(cfg.ExcludeDevices, device) {
+			delete(counters, device)
+		}
+	}
+	return counters
+}
+
+// diskIORates calculates the I/O rate per device. Devices without a previous
+// sample or with counters that went backwards are skipped.
+func diskIORates(prev, curr map[string]DiskIOCounters, timeDiff float64) []DiskIOUsage {
+	if timeDiff <= 0 {
+		return nil
+	}
+
+	devices := make([]string, 0, len(curr))
+	for device := range curr {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	var usages []DiskIOUsage
+	for _, device := range devices {
+		c := curr[device]
+		p, found := prev[device]
+		if !found || c.Reads < p.Reads || c.Writes < p.Writes || c.ReadBytes < p.ReadBytes ||
+			c.WriteBytes < p.WriteBytes || c.ReadTime < p.ReadTime || c.WriteTime < p.WriteTime || c.IOTime < p.IOTime {
+			continue
+		}
+
+		usage := DiskIOUsage{
+			Device:    device,
+			ReadBPS:   uint64(float64(c.ReadBytes-p.ReadBytes) / timeDiff),
+			WriteBPS:  uint64(float64(c.WriteBytes-p.WriteBytes) / timeDiff),
+			ReadIOPS:  float64(c.Reads-p.Reads) / timeDiff,
+			WriteIOPS: float64(c.Writes-p.Writes) / timeDiff,
+		}
+		if ios := (c.Reads - p.Reads) + (c.Writes - p.Writes); ios > 0 {
+			usage.AwaitMS = float64((c.ReadTime-p.ReadTime)+(c.WriteTime-p.WriteTime)) / float64(ios)
+		}
+		usage.UtilPercent = min(float64(c.IOTime-p.IOTime)/(timeDiff*1000)*100, 100)
+
+		usages = append(usages, usage)
+	}
+	return usages
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readDiskIOCounters parses /proc/diskstats. Sector counts are always in
+// 512 byte units, independent of the device's sector size.
+func readDiskIOCounters() map[string]DiskIOCounters {
+	data, err := readProcFile("diskstats")
+	if err != nil {
+		return nil
+	}
+
+	counters := make(map[string]DiskIOCounters)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		// major minor name reads merged sectors ms writes merged sectors ms in_flight io_ms ...
+		fields := bytes.Fields(line)
+		if len(fields) < 13 {
+			continue
+		}
+
+		value := func(i int) uint64 {
+			v, _ := strconv.ParseUint(string(fields[i]), 10, 64)
+			return v
+		}
+		counters[string(fields[2])] = DiskIOCounters{
+			Reads:      value(3),
+			ReadBytes:  value(5) * 512,
+			ReadTime:   value(6),
+			Writes:     value(7),
+			WriteBytes: value(9) * 512,
+			WriteTime:  value(10),
+			IOTime:     value(12),
+		}
+	}
+	return counters
+}
+
+// isDiskPartition reports whether sysfs marks the device as a partition.
+// Slashes in device names like cciss/c0d0p1 are replaced with "!" there.
+func isDiskPartition(device string) bool {
+	name := strings.ReplaceAll(device, "/", "!")
+	for _, root := range []string{"/host/sys", "/sys"} {
+		if _, err := os.Stat(root + "/class/block/" + name + "/partition"); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package main
+
+import "github.com/shirou/gopsutil/v3/disk"
+
+// readDiskIOCounters uses gopsutil on platforms without /proc. Request times
+// are not reported consistently there, so await and utilization stay 0.
+func readDiskIOCounters() map[string]DiskIOCounters {
+	stats, err := disk.IOCounters()
+	if err != nil {
+		return nil
+	}
+
+	counters := make(map[string]DiskIOCounters, len(stats))
+	for name, stat := range stats {
+		counters[name] = DiskIOCounters{
+			Reads:      stat.ReadCount,
+			Writes:     stat.WriteCount,
+			ReadBytes:  stat.ReadBytes,
+			WriteBytes: stat.WriteBytes,
+		}
+	}
+	return counters
+}
+
+// isDiskPartition is always false, gopsutil reports whole disks or volumes
+// there.
+func isDiskPartition(device string) bool {
+	return false
+}
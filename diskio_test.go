@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFilterDiskIOCounters(t *testing.T) {
+	partitions := map[string]bool{"sda1": true, "sda2": true, "nvme0n1p1": true}
+	isPartition := func(device string) bool { return partitions[device] }
+
+	tests := []struct {
+		name string
+		cfg  diskIOConfig
+		want []string
+	}{
+		{"defaults", diskIOConfig{}, []string{"nvme0n1", "sda"}},
+		{"partitions", diskIOConfig{IncludePartitions: true}, []string{"nvme0n1", "nvme0n1p1", "sda", "sda1", "sda2"}},
+		{"include", diskIOConfig{IncludeDevices: []string{"sd*", "loop0"}}, []string{"loop0", "sda"}},
+		{"exclude", diskIOConfig{ExcludeDevices: []string{"nvme*"}, IncludePartitions: true}, []string{"sda", "sda1", "sda2"}},
+	}
+	for _, tt := range tests {
+		counters := map[string]DiskIOCounters{}
+		for _, device := range []string{"sda", "sda1", "sda2", "nvme0n1", "nvme0n1p1", "loop0", "sr0"} {
+			counters[device] = DiskIOCounters{}
+		}
+
+		var got []string
+		for device := range filterDiskIOCounters(counters, tt.cfg, isPartition) {
+			got = append(got, device)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
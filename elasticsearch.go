@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	esRetryMinBackoff = 1 * time.Second
+	esRetryMaxBackoff = 5 * time.Minute
+	// Without spool a batch is given up after about two minutes
+	esRetryMaxAttempts = 8
+
+	// Well below the default http.max_content_length of 100 MB
+	esBatchMaxBytes = 5 * 1024 * 1024
+)
+
+// esSinkConfig is the config.json representation of an Elasticsearch or
+// OpenSearch sink.
+type esSinkConfig struct {
+	URL             string `json:"url"`
+	Index           string `json:"index"`
+	IndexDateFormat string `json:"index_date_format"` // Go layout appended to the index, "" for a fixed index
+	FieldNames      string `json:"field_names"`       // "clef" or "ecs"
+
+	Username string `json:"username"`
+	Password string `json:"password"`
+	APIKey   string `json:"api_key"` // base64 encoded "id:api_key"
+
+	CACert     string       `json:"ca_cert"`
+	ClientCert string       `json:"client_cert"`
+	ClientKey  string       `json:"client_key"`
+	Timeout    jsonDuration `json:"timeout"`
+
+	BatchSize     int          `json:"batch_size"`
+	FlushInterval jsonDuration `json:"flush_interval"`
+
+	spoolConfig
+}
+
+// esSink writes samples through the _bulk API. Documents get an ID derived
+// from host and timestamp and are sent with the create action, so a retried
+// request never indexes duplicates. After a partial failure only the
+// documents rejected temporarily are sent again.
+type esSink struct {
+	cfg     esSinkConfig
+	bulkURL string
+	client  *http.Client
+	batches *batcher
+}
+
+type esBulkResponse struct {
+	Errors bool                            `json:"errors"`
+	Items  []map[string]esBulkItemResponse `json:"items"`
+}
+
+type esBulkItemResponse struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func init() {
+	registerSink("elasticsearch", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := esSinkConfig{
+			Index:           "host-monitor",
+			IndexDateFormat: "2006.01.02",
+			FieldNames:      "clef",
+			Timeout:         jsonDuration(30 * time.Second),
+			BatchSize:       100,
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+
+		// Like for webhooks the spool is opt-in
+		if cfg.SpoolMaxSize == nil {
+			cfg.SpoolMaxSize = new(int)
+		}
+		sp, err := cfg.openSpool(name, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		return newESSink(name, cfg, sp)
+	})
+}
+
+func newESSink(name string, cfg esSinkConfig, sp *spool) (*esSink, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("url fehlt")
+	}
+	if cfg.FieldNames != "clef" && cfg.FieldNames != "ecs" {
+		return nil, fmt.Errorf("unbekannte Feldnamen %q", cfg.FieldNames)
+	}
+
+	client, err := newHTTPClient(cfg.CACert, cfg.ClientCert, cfg.ClientKey, time.Duration(cfg.Timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &esSink{
+		cfg:     cfg,
+		bulkURL: strings.TrimSuffix(cfg.URL, "/") + "/_bulk",
+		client:  client,
+	}
+	policy := retryPolicy{
+		MinBackoff: esRetryMinBackoff,
+		MaxBackoff: esRetryMaxBackoff,
+	}
+	if sp == nil {
+		// With a spool undelivered batches are kept until they are delivered
+		policy.MaxAttempts = esRetryMaxAttempts
+	}
+	queue := newDeliveryQueue(name, s.sendBulk, sp, policy)
+	s.batches = newBatcher(queue, cfg.BatchSize, esBatchMaxBytes, time.Duration(cfg.FlushInterval))
+
+	return s, nil
+}
+
+func (s *esSink) Send(metrics SystemMetrics) error {
+	ts := metricsTime(metrics).UTC()
+
+	index := s.cfg.Index
+	if s.cfg.IndexDateFormat != "" {
+		index += "-" + ts.Format(s.cfg.IndexDateFormat)
+	}
+
+	action := map[string]any{"create": map[string]string{
+		"_index": index,
+		"_id":    fmt.Sprintf("%s-%d", metrics.Hostname, ts.Unix()),
+	}}
+
+	var doc any = metrics
+	if s.cfg.FieldNames == "ecs" {
+		doc = esECSDocument(metrics)
+	}
+
+	// Spool records are single lines, so action and document are stored as
+	// a two-element array and split up when the request is built
+	record, err := json.Marshal([]any{action, doc})
+	if err != nil {
+		return fmt.Errorf("JSON-Encoding: %w", err)
+	}
+	return s.batches.Add(record)
+}
+
+func (s *esSink) Flush() error {
+	return s.batches.Flush()
+}
+
+func (s *esSink) Close() error {
+	return s.batches.Close()
+}
+
+func (s *esSink) sendBulk(records [][]byte) error {
+	var body bytes.Buffer
+	for _, record := range records {
+		var pair []json.RawMessage
+		if err := json.Unmarshal(record, &pair); err != nil || len(pair) != 2 {
+			return &permanentDeliveryError{fmt.Errorf("ungültiger Datensatz: %s", record)}
+		}
+		body.Write(pair[0])
+		body.WriteByte('\n')
+		body.Write(pair[1])
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.bulkURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+s.cfg.APIKey)
+	} else if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return checkHTTPResponse(resp)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var result esBulkResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("Antwort der Bulk-API: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+
+	return esBulkItemErrors(result, records)
+}
+
+// esBulkItemErrors evaluates the per-document results of a bulk request,
+// which are listed in request order. Conflicts mean the document was stored
+// by an earlier attempt. Documents that failed temporarily (429, 5xx) are
+// returned for a retry, documents rejected permanently are dropped.
+func esBulkItemErrors(result esBulkResponse, records [][]byte) error {
+	if len(result.Items) != len(records) {
+		return fmt.Errorf("Bulk-API meldet %d Ergebnisse für %d Dokumente", len(result.Items), len(records))
+	}
+
+	var retry [][]byte
+	var rejected int
+	var firstErr *httpStatusError
+
+	for i, item := range result.Items {
+		for _, r := range item {
+			if (r.Status >= 200 && r.Status < 300) || r.Status == http.StatusConflict {
+				continue
+			}
+
+			if r.Status == http.StatusTooManyRequests || r.Status >= 500 {
+				retry = append(retry, records[i])
+			} else {
+				rejected++
+			}
+			if firstErr == nil {
+				firstErr = &httpStatusError{StatusCode: r.Status, Body: string(r.Error)}
+			}
+		}
+	}
+
+	switch {
+	case len(retry) > 0:
+		return &partialDeliveryError{
+			remaining: retry,
+			err: fmt.Errorf("%d von %d Dokumenten nicht gespeichert, davon %d abgelehnt: %w",
+				len(retry)+rejected, len(result.Items), rejected, firstErr),
+		}
+	case rejected > 0:
+		return &permanentDeliveryError{fmt.Errorf("%d von %d Dokumenten abgelehnt: %w", rejected, len(result.Items), firstErr)}
+	}
+	return nil
+}
+
+// esECSDocument maps a sample to Elastic Common Schema field names. Values
+// without an ECS or Metricbeat counterpart are placed below host_monitor,
+// values per core, device, interface or process as arrays of objects.
+func esECSDocument(m SystemMetrics) map[string]any {
+	doc := map[string]any{
+		"@timestamp":    m.Timestamp,
+		"message":       "System Metrics from " + m.Hostname,
+		"service.name":  m.Application,
+		"event.dataset": "host_monitor.metrics",
+		"host.name":     m.Hostname,
+
+		"host.cpu.usage":                      m.CPUPercent / 100,
+		"system.memory.used.pct":              m.MemoryPercent / 100,
+		"system.memory.used.bytes":            int64(m.MemoryMB * 1024 * 1024),
+		"system.filesystem.used.pct":          m.DiskPercent / 100,
+		"system.filesystem.free":              int64(m.DiskFreeGB * 1024 * 1024 * 1024),
+		"system.socket.summary.tcp.all.count": m.TCPConnections,
+		"system.socket.summary.udp.all.count": m.UDPSockets,
+		"system.load.1":                       m.LoadAverage1,
+		"system.load.5":                       m.LoadAverage5,
+		"system.load.15":                      m.LoadAverage15,
+		"system.load.norm.1":                  m.LoadPerCPU1,
+		"system.load.norm.5":                  m.LoadPerCPU5,
+		"system.load.norm.15":                 m.LoadPerCPU15,
+		"system.process.summary.running":      m.ProcsRunning,
+		"host.uptime":                         m.UptimeSeconds,
+
+		"host_monitor.network.rx_bytes_per_second":   m.NetworkRXBPS,
+		"host_monitor.network.tx_bytes_per_second":   m.NetworkTXBPS,
+		"host_monitor.network.rx_packets_per_second": m.NetworkRXPPS,
+		"host_monitor.network.tx_packets_per_second": m.NetworkTXPPS,
+		"host_monitor.network.rx_errors":             m.NetworkRXErrors,
+		"host_monitor.network.tx_errors":             m.NetworkTXErrors,
+		"host_monitor.network.rx_drops":              m.NetworkRXDrops,
+		"host_monitor.network.tx_drops":              m.NetworkTXDrops,
+		"host_monitor.processes.not_running.count":   m.ProcessesNotRunningCount,
+		"host_monitor.ports.missing.count":           m.PortsMissingCount,
+		"host_monitor.procs.blocked":                 m.ProcsBlocked,
+		"host_monitor.socket.tcp.ipv4":               m.TCPIPv4,
+		"host_monitor.socket.tcp.ipv6":               m.TCPIPv6,
+		"host_monitor.socket.udp.ipv4":               m.UDPIPv4,
+		"host_monitor.socket.udp.ipv6":               m.UDPIPv6,
+	}
+	if m.BootTime != "" {
+		doc["host_monitor.boot_time"] = m.BootTime
+	}
+	if m.CPUModes != nil {
+		for _, v := range m.CPUModes.values() {
+			doc["system.cpu."+v.mode+".norm.pct"] = v.value / 100
+		}
+	}
+	if len(m.CPUCores) > 0 {
+		cores := make([]map[string]any, len(m.CPUCores))
+		for i, core := range m.CPUCores {
+			cores[i] = map[string]any{"id": core.Core, "usage.pct": core.Percent / 100}
+			for _, v := range core.CPUModes.values() {
+				cores[i][v.mode+".pct"] = v.value / 100
+			}
+		}
+		doc["host_monitor.cpu.cores"] = cores
+	}
+	if len(m.Disks) > 0 {
+		filesystems := make([]map[string]any, len(m.Disks))
+		for i, d := range m.Disks {
+			filesystems[i] = map[string]any{
+				"mount_point": d.Path,
+				"used.pct":    d.Percent / 100,
+				"free":        d.FreeBytes,
+				"used.bytes":  d.UsedBytes,
+				"total":       d.TotalBytes,
+				"files":       d.InodesTotal,
+				"free_files":  d.InodesFree,
+			}
+			if d.Device != "" {
+				filesystems[i]["device_name"] = d.Device
+			}
+			if d.FSType != "" {
+				filesystems[i]["type"] = d.FSType
+			}
+		}
+		doc["host_monitor.filesystems"] = filesystems
+	}
+	if len(m.DiskIO) > 0 {
+		diskIO := make([]map[string]any, len(m.DiskIO))
+		for i, d := range m.DiskIO {
+			diskIO[i] = map[string]any{
+				"name":                         d.Device,
+				"iostat.read.per_sec.bytes":    d.ReadBPS,
+				"iostat.write.per_sec.bytes":   d.WriteBPS,
+				"iostat.read.request.per_sec":  d.ReadIOPS,
+				"iostat.write.request.per_sec": d.WriteIOPS,
+				"iostat.await":                 d.AwaitMS,
+				"iostat.busy":                  d.UtilPercent,
+			}
+		}
+		doc["host_monitor.diskio"] = diskIO
+	}
+	if len(m.NetworkInterfaces) > 0 {
+		interfaces := make([]map[string]any, len(m.NetworkInterfaces))
+		for i, iface := range m.NetworkInterfaces {
+			interfaces[i] = map[string]any{
+				"name":                  iface.Interface,
+				"rx_bytes_per_second":   iface.RXBPS,
+				"tx_bytes_per_second":   iface.TXBPS,
+				"rx_packets_per_second": iface.RXPPS,
+				"tx_packets_per_second": iface.TXPPS,
+				"rx_errors":             iface.RXErrors,
+				"tx_errors":             iface.TXErrors,
+				"rx_drops":              iface.RXDrops,
+				"tx_drops":              iface.TXDrops,
+			}
+		}
+		doc["host_monitor.network.interfaces"] = interfaces
+	}
+	// Metricbeat names the LISTEN state "listening"
+	for _, state := range sortedStateNames(m.TCPStates) {
+		name := strings.ToLower(state)
+		if state == "LISTEN" {
+			name = "listening"
+		}
+		doc["system.socket.summary.tcp.all."+name] = m.TCPStates[state]
+	}
+	if len(m.ListeningPorts) > 0 {
+		ports := make([]map[string]any, len(m.ListeningPorts))
+		for i, port := range m.ListeningPorts {
+			ports[i] = map[string]any{
+				"protocol": port.Protocol,
+				"address":  port.Address,
+				"port":     port.Port,
+			}
+			if port.PID != 0 {
+				ports[i]["process.pid"] = port.PID
+				ports[i]["process.name"] = port.Process
+			}
+		}
+		doc["host_monitor.listening_ports"] = ports
+	}
+	if len(m.Processes) > 0 {
+		processes := make([]map[string]any, len(m.Processes))
+		for i, p := range m.Processes {
+			processes[i] = map[string]any{
+				"name":                      p.Name,
+				"instances":                 p.Instances,
+				"cpu.total.pct":             p.CPUPercent / 100,
+				"memory.rss.bytes":          p.RSSBytes,
+				"num_threads":               p.Threads,
+				"fd.open":                   p.OpenFDs,
+				"io.read_bytes_per_second":  p.ReadBPS,
+				"io.write_bytes_per_second": p.WriteBPS,
+				"uptime":                    p.UptimeSeconds,
+			}
+		}
+		doc["host_monitor.procstat"] = processes
+	}
+	if len(m.ProcessesNotRunning) > 0 {
+		doc["host_monitor.processes.not_running.names"] = m.ProcessesNotRunning
+	}
+	if len(m.PortsMissing) > 0 {
+		doc["host_monitor.ports.missing.names"] = m.PortsMissing
+	}
+	return doc
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func esTestRecord(id int) []byte {
+	return []byte(fmt.Sprintf(`[{"create":{"_index":"host-monitor","_id":"%d"}},{"n":%d}]`, id, id))
+}
+
+func TestESSinkRetriesOnlyFailedDocuments(t *testing.T) {
+	var mu sync.Mutex
+	var requests [][]string
+
+	// The first request stores document 1 and 4, rejects 3 and asks to retry 2
+	statuses := [][]int{{201, 429, 400, 201}, {201}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ids []string
+		scanner := bufio.NewScanner(r.Body)
+		for i := 0; scanner.Scan(); i++ {
+			if i%2 == 0 {
+				var action map[string]map[string]string
+				json.Unmarshal(scanner.Bytes(), &action)
+				ids = append(ids, action["create"]["_id"])
+			}
+		}
+
+		mu.Lock()
+		n := len(requests)
+		requests = append(requests, ids)
+		mu.Unlock()
+
+		var result esBulkResponse
+		for _, status := range statuses[n] {
+			result.Items = append(result.Items, map[string]esBulkItemResponse{"create": {Status: status}})
+			result.Errors = result.Errors || status >= 300
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer server.Close()
+
+	s := &esSink{bulkURL: server.URL + "/_bulk", client: server.Client()}
+	queue := newDeliveryQueue("es", s.sendBulk, nil, retryPolicy{MinBackoff: time.Millisecond, MaxAttempts: 3})
+	defer queue.Close()
+
+	if err := queue.Submit(esTestRecord(1), esTestRecord(2), esTestRecord(3), esTestRecord(4)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if got := strings.Join(requests[0], ","); got != "1,2,3,4" {
+		t.Errorf("first request contained %s", got)
+	}
+	if got := strings.Join(requests[1], ","); got != "2" {
+		t.Errorf("retry contained %s, want only 2", got)
+	}
+}
+
+func TestESBulkItemErrors(t *testing.T) {
+	records := [][]byte{esTestRecord(1), esTestRecord(2)}
+	item := func(status int) map[string]esBulkItemResponse {
+		return map[string]esBulkItemResponse{"create": {Status: status}}
+	}
+
+	tests := []struct {
+		name      string
+		statuses  []int
+		permanent bool
+		retry     int
+	}{
+		{"stored", []int{201, 201}, false, 0},
+		{"conflict is stored", []int{409, 201}, false, 0},
+		{"rejected", []int{201, 400}, true, 0},
+		{"retryable", []int{503, 201}, false, 1},
+	}
+	for _, tt := range tests {
+		var result esBulkResponse
+		for _, status := range tt.statuses {
+			result.Items = append(result.Items, item(status))
+		}
+
+		err := esBulkItemErrors(result, records)
+		if tt.retry == 0 && !tt.permanent {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		if isPermanentDeliveryError(err) != tt.permanent {
+			t.Errorf("%s: permanent = %t, want %t", tt.name, !tt.permanent, tt.permanent)
+		}
+		if tt.retry > 0 {
+			if remaining := remainingRecords(records, err); len(remaining) != tt.retry {
+				t.Errorf("%s: %d records to retry, want %d", tt.name, len(remaining), tt.retry)
+			}
+		}
+	}
+}
+
+func TestESECSDocumentCPU(t *testing.T) {
+	doc := esECSDocument(SystemMetrics{
+		CPUModes: &CPUModes{User: 10, IOWait: 5},
+		CPUCores: []CPUCoreUsage{{Core: "cpu0", Percent: 50, CPUModes: CPUModes{User: 50}}},
+	})
+
+	if doc["system.cpu.user.norm.pct"] != 0.1 || doc["system.cpu.iowait.norm.pct"] != 0.05 {
+		t.Errorf("modes = %v, %v", doc["system.cpu.user.norm.pct"], doc["system.cpu.iowait.norm.pct"])
+	}
+	cores, _ := doc["host_monitor.cpu.cores"].([]map[string]any)
+	if len(cores) != 1 || cores[0]["id"] != "cpu0" || cores[0]["usage.pct"] != 0.5 || cores[0]["user.pct"] != 0.5 {
+		t.Errorf("cores = %v", doc["host_monitor.cpu.cores"])
+	}
+}
+
+func TestESECSDocumentLoad(t *testing.T) {
+	doc := esECSDocument(SystemMetrics{LoadAverage1: 2, LoadPerCPU1: 0.5, ProcsBlocked: 3, UptimeSeconds: 60, BootTime: "2026-10-17T06:14:00Z"})
+
+	want := map[string]any{
+		"system.load.1":              2.0,
+		"system.load.norm.1":         0.5,
+		"host_monitor.procs.blocked": 3,
+		"host.uptime":                uint64(60),
+		"host_monitor.boot_time":     "2026-10-17T06:14:00Z",
+	}
+	for key, value := range want {
+		if doc[key] != value {
+			t.Errorf("%s = %v, want %v", key, doc[key], value)
+		}
+	}
+}
+
+func TestESECSDocumentFilesystems(t *testing.T) {
+	doc := esECSDocument(SystemMetrics{
+		DiskPercent: 40,
+		Disks: []DiskUsage{
+			{Path: "/", Device: "/dev/sda1", FSType: "ext4", Percent: 40, FreeBytes: 600, InodesFree: 90},
+			{Path: "/data", Percent: 75},
+		},
+	})
+
+	if doc["system.filesystem.used.pct"] != 0.4 {
+		t.Errorf("used.pct = %v", doc["system.filesystem.used.pct"])
+	}
+	filesystems, _ := doc["host_monitor.filesystems"].([]map[string]any)
+	if len(filesystems) != 2 {
+		t.Fatalf("filesystems = %v", doc["host_monitor.filesystems"])
+	}
+	if fs := filesystems[0]; fs["mount_point"] != "/" || fs["device_name"] != "/dev/sda1" || fs["type"] != "ext4" ||
+		fs["used.pct"] != 0.4 || fs["free"] != uint64(600) || fs["free_files"] != uint64(90) {
+		t.Errorf("root filesystem = %v", fs)
+	}
+	if fs := filesystems[1]; fs["used.pct"] != 0.75 || fs["device_name"] != nil || fs["type"] != nil {
+		t.Errorf("/data filesystem = %v", fs)
+	}
+}
+
+func TestESECSDocumentDiskIO(t *testing.T) {
+	doc := esECSDocument(SystemMetrics{
+		DiskIO: []DiskIOUsage{{Device: "nvme0n1", ReadBPS: 4096, WriteIOPS: 12.5, AwaitMS: 0.5, UtilPercent: 40}},
+	})
+
+	diskIO, _ := doc["host_monitor.diskio"].([]map[string]any)
+	if len(diskIO) != 1 {
+		t.Fatalf("diskio = %v", doc["host_monitor.diskio"])
+	}
+	want := map[string]any{
+		"name":                         "nvme0n1",
+		"iostat.read.per_sec.bytes":    uint64(4096),
+		"iostat.write.request.per_sec": 12.5,
+		"iostat.await":                 0.5,
+		"iostat.busy":                  40.0,
+	}
+	for key, value := range want {
+		if diskIO[0][key] != value {
+			t.Errorf("%s = %v, want %v", key, diskIO[0][key], value)
+		}
+	}
+}
+
+func TestESECSDocumentNetwork(t *testing.T) {
+	doc := esECSDocument(SystemMetrics{
+		NetworkRXDrops:    4,
+		NetworkInterfaces: []NetworkInterfaceUsage{{Interface: "eth0", TXPPS: 12.5}},
+	})
+
+	if doc["host_monitor.network.rx_drops"] != uint64(4) {
+		t.Errorf("rx_drops = %v", doc["host_monitor.network.rx_drops"])
+	}
+	interfaces, _ := doc["host_monitor.network.interfaces"].([]map[string]any)
+	if len(interfaces) != 1 || interfaces[0]["name"] != "eth0" || interfaces[0]["tx_packets_per_second"] != 12.5 {
+		t.Errorf("interfaces = %v", doc["host_monitor.network.interfaces"])
+	}
+}
+
+func TestESECSDocumentSockets(t *testing.T) {
+	doc := esECSDocument(SystemMetrics{
+		TCPStates:      map[string]int{"LISTEN": 3, "CLOSE_WAIT": 1},
+		UDPSockets:     5,
+		ListeningPorts: []ListeningPort{{Protocol: "udp", Address: "::", Port: 53}},
+	})
+
+	want := map[string]any{
+		"system.socket.summary.tcp.all.listening":  3,
+		"system.socket.summary.tcp.all.close_wait": 1,
+		"system.socket.summary.udp.all.count":      5,
+	}
+	for key, value := range want {
+		if doc[key] != value {
+			t.Errorf("%s = %v, want %v", key, doc[key], value)
+		}
+	}
+	ports, _ := doc["host_monitor.listening_ports"].([]map[string]any)
+	if len(ports) != 1 || ports[0]["port"] != uint32(53) || ports[0]["process.pid"] != nil {
+		t.Errorf("listening ports = %v", doc["host_monitor.listening_ports"])
+	}
+}
+
+func TestESECSDocumentProcesses(t *testing.T) {
+	doc := esECSDocument(SystemMetrics{
+		Processes: []ProcessUsage{{Name: "nginx", Instances: 4, CPUPercent: 150, Threads: 9}},
+	})
+
+	processes, _ := doc["host_monitor.procstat"].([]map[string]any)
+	if len(processes) != 1 || processes[0]["name"] != "nginx" || processes[0]["cpu.total.pct"] != 1.5 || processes[0]["num_threads"] != 9 {
+		t.Errorf("processes = %v", doc["host_monitor.procstat"])
+	}
+}
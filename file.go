@@ -0,0 +1,277 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rotation defaults of --file-* flags and file entries in config.json
+const (
+	fileDefaultMaxSizeMB      = 100
+	fileDefaultRotateInterval = 24 * time.Hour
+	fileDefaultMaxFiles       = 7
+
+	fileRotateLayout = "20060102T150405"
+)
+
+type fileSinkOptions struct {
+	Path           string
+	MaxSizeMB      int           // rotate once the file reaches this size, 0 disables
+	RotateInterval time.Duration // rotate at multiples of this interval, 0 disables
+	MaxFiles       int           // number of rotated files to keep, 0 keeps all
+	Compress       bool          // gzip rotated files
+}
+
+// fileSink appends every sample as a CLEF/JSON line to a local file. The file
+// is rotated by size and age; rotated files are named after the rotation time
+// and can be imported into Seq with `seqcli ingest --json`.
+type fileSink struct {
+	opts fileSinkOptions
+
+	file      *os.File
+	size      int64
+	lastWrite time.Time
+}
+
+func init() {
+	registerSink("file", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := struct {
+			Path           string       `json:"path"`
+			MaxSize        int          `json:"max_size"`
+			RotateInterval jsonDuration `json:"rotate_interval"`
+			MaxFiles       int          `json:"max_files"`
+			Compress       bool         `json:"compress"`
+		}{
+			MaxSize:        fileDefaultMaxSizeMB,
+			RotateInterval: jsonDuration(fileDefaultRotateInterval),
+			MaxFiles:       fileDefaultMaxFiles,
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Path == "" {
+			return nil, errors.New("path fehlt")
+		}
+
+		return newFileSink(fileSinkOptions{
+			Path:           cfg.Path,
+			MaxSizeMB:      cfg.MaxSize,
+			RotateInterval: time.Duration(cfg.RotateInterval),
+			MaxFiles:       cfg.MaxFiles,
+			Compress:       cfg.Compress,
+		})
+	})
+}
+
+func newFileSink(opts fileSinkOptions) (*fileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &fileSink{opts: opts}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) Send(metrics SystemMetrics) error {
+	jsonData, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+
+	if s.needsRotation() {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(append(jsonData, '\n'))
+	s.size += int64(n)
+	s.lastWrite = time.Now()
+	return err
+}
+
+func (s *fileSink) Flush() error {
+	return s.file.Sync()
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.file = f
+	s.size = info.Size()
+	s.lastWrite = info.ModTime()
+	return nil
+}
+
+// needsRotation reports whether the file reached its size limit or was last
+// written in an earlier rotation interval. Intervals start at fixed points in
+// time, e.g. midnight UTC for 24h, and the last write is taken from the file's
+// modification time after a restart, so restarts do not postpone rotation.
+func (s *fileSink) needsRotation() bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.opts.MaxSizeMB > 0 && s.size >= int64(s.opts.MaxSizeMB)*1024*1024 {
+		return true
+	}
+	return s.opts.RotateInterval > 0 && s.lastWrite.Before(time.Now().Truncate(s.opts.RotateInterval))
+}
+
+// rotate renames the current file to <name>-<timestamp><ext>, optionally
+// compresses it and removes rotated files beyond the retention count.
+// Rotations within the same second get a sequence number,
+// e.g. metrics-20261017T061500-1.clef.
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(s.opts.Path)
+	base := strings.TrimSuffix(s.opts.Path, ext)
+	stamp := base + "-" + time.Now().Format(fileRotateLayout)
+	rotated := stamp + ext
+	for seq := 1; fileExists(rotated) || fileExists(rotated+".gz"); seq++ {
+		rotated = stamp + "-" + strconv.Itoa(seq) + ext
+	}
+
+	if err := os.Rename(s.opts.Path, rotated); err != nil {
+		// Keep writing to the current file rather than losing samples
+		if openErr := s.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	if s.opts.Compress {
+		if err := gzipFile(rotated); err != nil {
+			logError("Fehler beim Komprimieren von %s: %v", rotated, err)
+		}
+	}
+
+	s.removeOldFiles(base, ext)
+	return nil
+}
+
+func (s *fileSink) removeOldFiles(base, ext string) {
+	if s.opts.MaxFiles <= 0 {
+		return
+	}
+
+	matches, err := filepath.Glob(base + "-*")
+	if err != nil {
+		return
+	}
+
+	type rotatedFile struct {
+		path string
+		time time.Time
+		seq  int
+	}
+	var rotated []rotatedFile
+	for _, match := range matches {
+		// Other files sharing the prefix, e.g. metrics-old, are left alone
+		if t, seq, ok := parseRotatedName(match, base, ext); ok {
+			rotated = append(rotated, rotatedFile{match, t, seq})
+		}
+	}
+
+	sort.Slice(rotated, func(i, j int) bool {
+		if !rotated[i].time.Equal(rotated[j].time) {
+			return rotated[i].time.Before(rotated[j].time)
+		}
+		return rotated[i].seq < rotated[j].seq
+	})
+	for len(rotated) > s.opts.MaxFiles {
+		if err := os.Remove(rotated[0].path); err != nil {
+			logError("Fehler beim Löschen von %s: %v", rotated[0].path, err)
+		}
+		rotated = rotated[1:]
+	}
+}
+
+// parseRotatedName returns the rotation time and sequence number of a file
+// named <base>-<timestamp>[-<seq>]<ext>[.gz]; ok is false for other files.
+func parseRotatedName(path, base, ext string) (t time.Time, seq int, ok bool) {
+	name, found := strings.CutPrefix(path, base+"-")
+	if !found {
+		return time.Time{}, 0, false
+	}
+	name = strings.TrimSuffix(name, ".gz")
+	if name, found = strings.CutSuffix(name, ext); !found {
+		return time.Time{}, 0, false
+	}
+
+	stamp, seqPart, hasSeq := strings.Cut(name, "-")
+	t, err := time.Parse(fileRotateLayout, stamp)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	if hasSeq {
+		if seq, err = strconv.Atoi(seqPart); err != nil || seq < 1 {
+			return time.Time{}, 0, false
+		}
+	}
+	return t, seq, true
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// gzipFile compresses path to path.gz and removes the original.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	in.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFileSinkConfigDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.clef")
+	raw, _ := json.Marshal(map[string]string{"type": "file", "path": path})
+
+	sink, err := sinkFactories["file"]("file-1", raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	opts := sink.(*fileSink).opts
+	if opts.MaxSizeMB != fileDefaultMaxSizeMB || opts.RotateInterval != fileDefaultRotateInterval || opts.MaxFiles != fileDefaultMaxFiles {
+		t.Errorf("options = %+v, want the --file-* defaults", opts)
+	}
+}
+
+func TestFileSinkConfigDisablesRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.clef")
+	raw, _ := json.Marshal(map[string]any{"path": path, "max_size": 0, "rotate_interval": "0s", "max_files": 0})
+
+	sink, err := sinkFactories["file"]("file-1", raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if opts := sink.(*fileSink).opts; opts.MaxSizeMB != 0 || opts.RotateInterval != 0 || opts.MaxFiles != 0 {
+		t.Errorf("options = %+v, want rotation disabled", opts)
+	}
+}
+
+func TestFileSinkRotatesFileFromEarlierInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.clef")
+	if err := os.WriteFile(path, []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Last written two days ago, e.g. before a restart
+	past := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := newFileSink(fileSinkOptions{Path: path, RotateInterval: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.Send(SystemMetrics{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "metrics-*.clef"))
+	if len(rotated) != 1 {
+		t.Fatalf("rotated files = %v, want one", rotated)
+	}
+	if data, _ := os.ReadFile(rotated[0]); string(data) != "{}\n" {
+		t.Errorf("rotated file contains %q", data)
+	}
+	if data, _ := os.ReadFile(path); bytes.Count(data, []byte("\n")) != 1 {
+		t.Errorf("current file contains %q, want only the new sample", data)
+	}
+}
+
+func TestFileSinkKeepsFileOfCurrentInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.clef")
+	if err := os.WriteFile(path, []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart right after the previous write must not rotate
+	sink, err := newFileSink(fileSinkOptions{Path: path, RotateInterval: 1000 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.Send(SystemMetrics{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rotated, _ := filepath.Glob(filepath.Join(dir, "metrics-*.clef")); len(rotated) != 0 {
+		t.Errorf("rotated files = %v, want none", rotated)
+	}
+}
+
+func TestFileSinkRotatesBySizeAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.clef")
+	for _, name := range []string{"metrics-20260101T000000.clef.gz", "metrics-20260102T000000.clef.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), 1024*1024), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := newFileSink(fileSinkOptions{Path: path, MaxSizeMB: 1, MaxFiles: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.Send(SystemMetrics{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "metrics-*.clef*"))
+	if len(rotated) != 2 || filepath.Base(rotated[0]) != "metrics-20260102T000000.clef.gz" {
+		t.Errorf("rotated files = %v, want the newest two", rotated)
+	}
+	if info, _ := os.Stat(path); info.Size() >= 1024*1024 {
+		t.Errorf("current file not rotated, %d bytes", info.Size())
+	}
+}
+
+func TestFileSinkPrunesOnlyRotatedFilesWithoutExtension(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics")
+	for _, name := range []string{"metrics-foo", "metrics-20260101T000000", "metrics-20260102T000000.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := newFileSink(fileSinkOptions{Path: path, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "metrics-foo")); err != nil {
+		t.Errorf("foreign file removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "metrics-20260101T000000")); err == nil {
+		t.Error("oldest rotated file kept")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "metrics-20260102T000000.gz")); err != nil {
+		t.Errorf("newer rotated file removed: %v", err)
+	}
+}
+
+func TestFileSinkRotatesTwiceWithinOneSecond(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.clef")
+
+	sink, err := newFileSink(fileSinkOptions{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	for _, line := range []string{"first", "second"} {
+		if _, err := sink.file.WriteString(line + "\n"); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both files survive even if the second rotation fell into the same second
+	rotated, _ := filepath.Glob(filepath.Join(dir, "metrics-*.clef"))
+	if len(rotated) != 2 {
+		t.Fatalf("rotated files = %v, want two", rotated)
+	}
+	var contents []string
+	for _, name := range rotated {
+		data, _ := os.ReadFile(name)
+		contents = append(contents, string(data))
+	}
+	if !slices.Contains(contents, "first\n") || !slices.Contains(contents, "second\n") {
+		t.Errorf("rotated contents = %q", contents)
+	}
+}
+
+func TestParseRotatedName(t *testing.T) {
+	tests := []struct {
+		path, base, ext string
+		seq             int
+		ok              bool
+	}{
+		{"/log/metrics-20261017T061500.clef", "/log/metrics", ".clef", 0, true},
+		{"/log/metrics-20261017T061500-2.clef.gz", "/log/metrics", ".clef", 2, true},
+		{"/log/metrics-20261017T061500", "/log/metrics", "", 0, true},
+		{"/log/metrics-foo", "/log/metrics", "", 0, false},
+		{"/log/metrics-20261017T061500.bak", "/log/metrics", "", 0, false},
+		{"/log/metrics-20261017T061500-x.clef", "/log/metrics", ".clef", 0, false},
+		{"/log/metrics-20261017T061500.json", "/log/metrics", ".clef", 0, false},
+	}
+	for _, tt := range tests {
+		_, seq, ok := parseRotatedName(tt.path, tt.base, tt.ext)
+		if ok != tt.ok || seq != tt.seq {
+			t.Errorf("%s: seq = %d, ok = %t, want %d, %t", tt.path, seq, ok, tt.seq, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// flatMetric is a single value for sinks without a label model.
+// Values of one core, device, interface or process name it as instance,
+// e.g. disk_io.read_bytes_per_second with device=sda.
+type flatMetric struct {
+	name     string // dotted, e.g. "disk_io.read_bytes_per_second"
+	dim      string // e.g. "device", empty for host-wide values
+	instance string
+	value    float64
+}
+
+// path inserts the instance after the first element of the name, e.g.
+// "disk_io.sda.read_bytes_per_second". elem escapes the instance.
+func (f flatMetric) path(elem func(string) string) string {
+	if f.dim == "" {
+		return f.name
+	}
+	group, rest, _ := strings.Cut(f.name, ".")
+	return group + "." + elem(f.instance) + "." + rest
+}
+
+// flattenMetrics returns the values of a sample for StatsD, Graphite, Splunk
+// and Syslog, starting with the summary values like cpu.percent. The sinks
+// only apply their naming and tagging. Values of the same instance are
+// adjacent.
+func flattenMetrics(m SystemMetrics) []flatMetric {
+	metrics := []flatMetric{
+		{name: "cpu.percent", value: m.CPUPercent},
+		{name: "memory.percent", value: m.MemoryPercent},
+		{name: "memory.used_mb", value: m.MemoryMB},
+		{name: "disk.percent", value: m.DiskPercent},
+		{name: "disk.free_gb", value: m.DiskFreeGB},
+		{name: "network.rx_bytes_per_second", value: float64(m.NetworkRXBPS)},
+		{name: "network.tx_bytes_per_second", value: float64(m.NetworkTXBPS)},
+		{name: "tcp.connections", value: float64(m.TCPConnections)},
+		{name: "processes.not_running", value: float64(m.ProcessesNotRunningCount)},
+		{name: "ports.missing", value: float64(m.PortsMissingCount)},
+	}
+	add := func(name string, value float64) {
+		metrics = append(metrics, flatMetric{name: name, value: value})
+	}
+	addInstance := func(dim, instance string) func(string, float64) {
+		return func(name string, value float64) {
+			metrics = append(metrics, flatMetric{name: name, dim: dim, instance: instance, value: value})
+		}
+	}
+
+	if m.CPUModes != nil {
+		flattenCPUModes(add, *m.CPUModes)
+	}
+	for _, core := range m.CPUCores {
+		add := addInstance("core", core.Core)
+		add("cpu.percent", core.Percent)
+		flattenCPUModes(add, core.CPUModes)
+	}
+
+	add("system.load1", m.LoadAverage1)
+	add("system.load5", m.LoadAverage5)
+	add("system.load15", m.LoadAverage15)
+	add("system.load1_per_cpu", m.LoadPerCPU1)
+	add("system.load5_per_cpu", m.LoadPerCPU5)
+	add("system.load15_per_cpu", m.LoadPerCPU15)
+	add("system.procs_running", float64(m.ProcsRunning))
+	add("system.procs_blocked", float64(m.ProcsBlocked))
+	add("system.uptime_seconds", float64(m.UptimeSeconds))
+	if bootTime, err := time.Parse(time.RFC3339, m.BootTime); err == nil {
+		add("system.boot_time", float64(bootTime.Unix()))
+	}
+
+	for _, d := range m.Disks {
+		add := addInstance("mountpoint", d.Path)
+		add("disk.percent", d.Percent)
+		add("disk.free_bytes", float64(d.FreeBytes))
+		add("disk.used_bytes", float64(d.UsedBytes))
+		add("disk.total_bytes", float64(d.TotalBytes))
+		add("disk.inodes_percent", d.InodesPercent)
+		add("disk.inodes_free", float64(d.InodesFree))
+		add("disk.inodes_total", float64(d.InodesTotal))
+	}
+	for _, d := range m.DiskIO {
+		add := addInstance("device", d.Device)
+		add("disk_io.read_bytes_per_second", float64(d.ReadBPS))
+		add("disk_io.write_bytes_per_second", float64(d.WriteBPS))
+		add("disk_io.reads_per_second", d.ReadIOPS)
+		add("disk_io.writes_per_second", d.WriteIOPS)
+		add("disk_io.await_ms", d.AwaitMS)
+		add("disk_io.util_percent", d.UtilPercent)
+	}
+
+	add("network.rx_packets_per_second", m.NetworkRXPPS)
+	add("network.tx_packets_per_second", m.NetworkTXPPS)
+	add("network.rx_errors", float64(m.NetworkRXErrors))
+	add("network.tx_errors", float64(m.NetworkTXErrors))
+	add("network.rx_drops", float64(m.NetworkRXDrops))
+	add("network.tx_drops", float64(m.NetworkTXDrops))
+	for _, iface := range m.NetworkInterfaces {
+		add := addInstance("interface", iface.Interface)
+		add("network.rx_bytes_per_second", float64(iface.RXBPS))
+		add("network.tx_bytes_per_second", float64(iface.TXBPS))
+		add("network.rx_packets_per_second", iface.RXPPS)
+		add("network.tx_packets_per_second", iface.TXPPS)
+		add("network.rx_errors", float64(iface.RXErrors))
+		add("network.tx_errors", float64(iface.TXErrors))
+		add("network.rx_drops", float64(iface.RXDrops))
+		add("network.tx_drops", float64(iface.TXDrops))
+	}
+
+	add("tcp.ipv4", float64(m.TCPIPv4))
+	add("tcp.ipv6", float64(m.TCPIPv6))
+	for _, state := range sortedStateNames(m.TCPStates) {
+		add("tcp.state."+strings.ToLower(state), float64(m.TCPStates[state]))
+	}
+	add("udp.sockets", float64(m.UDPSockets))
+	add("udp.ipv4", float64(m.UDPIPv4))
+	add("udp.ipv6", float64(m.UDPIPv6))
+
+	for _, p := range m.Processes {
+		add := addInstance("process", p.Name)
+		add("process.instances", float64(p.Instances))
+		add("process.cpu_percent", p.CPUPercent)
+		add("process.rss_bytes", float64(p.RSSBytes))
+		add("process.threads", float64(p.Threads))
+		add("process.open_fds", float64(p.OpenFDs))
+		add("process.read_bytes_per_second", float64(p.ReadBPS))
+		add("process.write_bytes_per_second", float64(p.WriteBPS))
+		add("process.uptime_seconds", float64(p.UptimeSeconds))
+	}
+
+	return metrics
+}
+
+// withoutTotals drops the host-wide values that are also reported per
+// instance under the same name, e.g. network.rx_bytes_per_second next to the
+// values per interface. Sinks that tag the instance instead of naming it
+// would otherwise mix the total with its parts in one series.
+func withoutTotals(metrics []flatMetric) []flatMetric {
+	perInstance := make(map[string]bool)
+	for _, f := range metrics {
+		if f.dim != "" {
+			perInstance[f.name] = true
+		}
+	}
+
+	var result []flatMetric
+	for _, f := range metrics {
+		if f.dim != "" || !perInstance[f.name] {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+func flattenCPUModes(add func(string, float64), modes CPUModes) {
+	for _, v := range modes.values() {
+		add("cpu."+v.mode+"_percent", v.value)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFlatMetricPath(t *testing.T) {
+	tests := []struct {
+		metric flatMetric
+		want   string
+	}{
+		{flatMetric{name: "cpu.user_percent"}, "cpu.user_percent"},
+		{flatMetric{name: "cpu.percent", dim: "core", instance: "cpu0"}, "cpu.cpu0.percent"},
+		{flatMetric{name: "disk_io.read_bytes_per_second", dim: "device", instance: "dm-0"}, "disk_io.dm-0.read_bytes_per_second"},
+		{flatMetric{name: "disk.percent", dim: "mountpoint", instance: "/var/lib"}, "disk._var_lib.percent"},
+	}
+	for _, tt := range tests {
+		if got := tt.metric.path(graphitePathElement); got != tt.want {
+			t.Errorf("path() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestFlattenMetricsSummary(t *testing.T) {
+	metrics := flattenMetrics(SystemMetrics{CPUPercent: 12.5, MemoryMB: 512, NetworkRXBPS: 2048, PortsMissingCount: 1})
+
+	// The summary values lead the list in a fixed order
+	want := []flatMetric{
+		{name: "cpu.percent", value: 12.5},
+		{name: "memory.percent"},
+		{name: "memory.used_mb", value: 512},
+		{name: "disk.percent"},
+		{name: "disk.free_gb"},
+		{name: "network.rx_bytes_per_second", value: 2048},
+		{name: "network.tx_bytes_per_second"},
+		{name: "tcp.connections"},
+		{name: "processes.not_running"},
+		{name: "ports.missing", value: 1},
+	}
+	if len(metrics) < len(want) || !slices.Equal(metrics[:len(want)], want) {
+		t.Errorf("summary values = %v", metrics[:min(len(metrics), len(want))])
+	}
+}
+
+func TestFlattenMetricsDetails(t *testing.T) {
+	tests := []struct {
+		name   string
+		m      SystemMetrics
+		prefix string
+		want   map[string]float64
+		count  int // number of values with prefix
+		absent []string
+	}{
+		{
+			name: "cpu",
+			m: SystemMetrics{
+				CPUModes: &CPUModes{User: 10, Idle: 90},
+				CPUCores: []CPUCoreUsage{{Core: "cpu0", Percent: 20, CPUModes: CPUModes{User: 20, Idle: 80}}},
+			},
+			prefix: "cpu.",
+			want: map[string]float64{
+				"cpu.user_percent":       10,
+				"cpu.idle_percent":       90,
+				"cpu.cpu0.percent":       20,
+				"cpu.cpu0.user_percent":  20,
+				"cpu.cpu0.idle_percent":  80,
+				"cpu.cpu0.steal_percent": 0,
+			},
+			count: 22, // usage and 10 modes in total and for the core
+		},
+		{
+			name: "load",
+			m: SystemMetrics{
+				LoadAverage1:  1.5,
+				LoadPerCPU15:  0.25,
+				ProcsBlocked:  2,
+				UptimeSeconds: 3600,
+				BootTime:      "2026-10-17T05:15:00Z",
+			},
+			prefix: "system.",
+			want: map[string]float64{
+				"system.load1":          1.5,
+				"system.load15_per_cpu": 0.25,
+				"system.procs_blocked":  2,
+				"system.uptime_seconds": 3600,
+				"system.boot_time":      1792214100,
+			},
+			count: 10,
+		},
+		{
+			name:   "load without boot time",
+			m:      SystemMetrics{LoadAverage1: 1.5},
+			prefix: "system.",
+			want:   map[string]float64{"system.load1": 1.5},
+			count:  9,
+			absent: []string{"system.boot_time"},
+		},
+		{
+			name: "filesystems",
+			m: SystemMetrics{Disks: []DiskUsage{
+				{Path: "/", Percent: 50, FreeBytes: 100},
+				{Path: "/var/lib", Percent: 75, InodesTotal: 1000},
+			}},
+			prefix: "disk.",
+			want: map[string]float64{
+				"disk._.percent":             50,
+				"disk._.free_bytes":          100,
+				"disk._var_lib.percent":      75,
+				"disk._var_lib.inodes_total": 1000,
+			},
+			count: 16, // 2 summary values and 7 per filesystem
+		},
+		{
+			name:   "disk I/O",
+			m:      SystemMetrics{DiskIO: []DiskIOUsage{{Device: "nvme0n1", ReadBPS: 4096, WriteIOPS: 12.5, UtilPercent: 40}}},
+			prefix: "disk_io.",
+			want: map[string]float64{
+				"disk_io.nvme0n1.read_bytes_per_second": 4096,
+				"disk_io.nvme0n1.writes_per_second":     12.5,
+				"disk_io.nvme0n1.util_percent":          40,
+				"disk_io.nvme0n1.await_ms":              0,
+			},
+			count: 6,
+		},
+		{
+			name: "network",
+			m: SystemMetrics{
+				NetworkRXPPS:      10,
+				NetworkTXDrops:    2,
+				NetworkInterfaces: []NetworkInterfaceUsage{{Interface: "eth0", RXBPS: 2048, TXErrors: 1}},
+			},
+			prefix: "network.",
+			want: map[string]float64{
+				"network.rx_packets_per_second":      10,
+				"network.tx_drops":                   2,
+				"network.eth0.rx_bytes_per_second":   2048,
+				"network.eth0.tx_errors":             1,
+				"network.eth0.tx_packets_per_second": 0,
+			},
+			count: 16, // 8 in total and 8 for the interface
+		},
+		{
+			name: "tcp",
+			m: SystemMetrics{
+				TCPIPv6:        3,
+				TCPStates:      map[string]int{"ESTABLISHED": 4, "TIME_WAIT": 2},
+				ListeningPorts: []ListeningPort{{Protocol: "tcp", Port: 22}},
+			},
+			prefix: "tcp.",
+			want: map[string]float64{
+				"tcp.ipv4":              0,
+				"tcp.ipv6":              3,
+				"tcp.state.established": 4,
+				"tcp.state.time_wait":   2,
+			},
+			count: 5,
+		},
+		{
+			name:   "udp",
+			m:      SystemMetrics{UDPSockets: 5, UDPIPv4: 5},
+			prefix: "udp.",
+			want:   map[string]float64{"udp.sockets": 5, "udp.ipv4": 5, "udp.ipv6": 0},
+			count:  3,
+		},
+		{
+			name:   "processes",
+			m:      SystemMetrics{Processes: []ProcessUsage{{Name: "nginx", Instances: 4, CPUPercent: 150, RSSBytes: 1 << 20}}},
+			prefix: "process.",
+			want: map[string]float64{
+				"process.nginx.instances":   4,
+				"process.nginx.cpu_percent": 150,
+				"process.nginx.rss_bytes":   1 << 20,
+				"process.nginx.open_fds":    0,
+			},
+			count: 8,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := flatTestValues(tt.m, tt.prefix)
+			assertFlattened(t, values, tt.want)
+			if len(values) != tt.count {
+				t.Errorf("got %d values, want %d", len(values), tt.count)
+			}
+			for _, path := range tt.absent {
+				if _, ok := values[path]; ok {
+					t.Errorf("unexpected %s", path)
+				}
+			}
+		})
+	}
+}
+
+func TestWithoutTotals(t *testing.T) {
+	metrics := withoutTotals(flattenMetrics(SystemMetrics{
+		CPUPercent:        20,
+		NetworkRXBPS:      300,
+		NetworkInterfaces: []NetworkInterfaceUsage{{Interface: "eth0", RXBPS: 300}},
+	}))
+
+	var names []string
+	for _, f := range metrics {
+		if f.dim == "" {
+			names = append(names, f.name)
+		}
+	}
+	if slices.Contains(names, "network.rx_bytes_per_second") || slices.Contains(names, "network.tx_drops") {
+		t.Errorf("host-wide network values kept next to eth0: %v", names)
+	}
+	if !slices.Contains(names, "cpu.percent") {
+		t.Errorf("cpu.percent dropped without values per core: %v", names)
+	}
+}
+
+// assertFlattened reports every path of want that is missing in values or
+// has a different value.
+func assertFlattened(t *testing.T, values, want map[string]float64) {
+	t.Helper()
+	for path, value := range want {
+		if got, ok := values[path]; !ok || got != value {
+			t.Errorf("%s = %v (present %t), want %v", path, got, ok, value)
+		}
+	}
+}
+
+// flatTestValues returns the flattened values by path whose path starts
+// with prefix.
+func flatTestValues(m SystemMetrics, prefix string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, f := range flattenMetrics(m) {
+		if path := f.path(graphitePathElement); strings.HasPrefix(path, prefix) {
+			values[path] = f.value
+		}
+	}
+	return values
+}
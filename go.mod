@@ -3,6 +3,7 @@ module host-monitor
 go 1.21
 
 require (
+	github.com/golang/snappy v0.0.4
 	github.com/shirou/gopsutil/v3 v3.23.12
 	golang.org/x/sys v0.15.0
 )
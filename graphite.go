@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphiteSinkConfig is the config.json representation of a Graphite sink.
+type graphiteSinkConfig struct {
+	Address  string       `json:"address"`
+	Protocol string       `json:"protocol"` // "plaintext" or "pickle"
+	Prefix   string       `json:"prefix"`
+	Timeout  jsonDuration `json:"timeout"`
+}
+
+// graphiteSink writes samples to carbon over TCP, either in the plaintext
+// protocol or as pickled batch. Connections closed by carbon are replaced
+// before writing, and like the syslog sink it reconnects once after a write
+// error.
+type graphiteSink struct {
+	cfg  graphiteSinkConfig
+	conn net.Conn
+}
+
+type graphiteMetric struct {
+	path  string
+	value float64
+}
+
+func init() {
+	registerSink("graphite", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := graphiteSinkConfig{
+			Protocol: "plaintext",
+			Prefix:   "hosts",
+			Timeout:  jsonDuration(10 * time.Second),
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+
+		switch cfg.Protocol {
+		case "plaintext":
+			if cfg.Address == "" {
+				cfg.Address = "localhost:2003"
+			}
+		case "pickle":
+			if cfg.Address == "" {
+				cfg.Address = "localhost:2004"
+			}
+		default:
+			return nil, fmt.Errorf("unbekanntes Protokoll %q", cfg.Protocol)
+		}
+
+		return &graphiteSink{cfg: cfg}, nil
+	})
+}
+
+func (s *graphiteSink) Send(metrics SystemMetrics) error {
+	var payload []byte
+	if s.cfg.Protocol == "pickle" {
+		payload = graphitePickle(s.metrics(metrics), metricsTime(metrics).Unix())
+	} else {
+		payload = graphitePlaintext(s.metrics(metrics), metricsTime(metrics).Unix())
+	}
+
+	// One retry with a fresh connection, e.g. after carbon restarted
+	for attempt := 0; ; attempt++ {
+		if err := s.connect(); err != nil {
+			return err
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(time.Duration(s.cfg.Timeout)))
+		_, err := s.conn.Write(payload)
+		if err == nil {
+			return nil
+		}
+
+		s.conn.Close()
+		s.conn = nil
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+func (s *graphiteSink) Flush() error {
+	return nil
+}
+
+func (s *graphiteSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *graphiteSink) connect() error {
+	if s.conn != nil {
+		if graphiteConnAlive(s.conn) {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	var err error
+	s.conn, err = net.DialTimeout("tcp", s.cfg.Address, time.Duration(s.cfg.Timeout))
+	return err
+}
+
+// graphiteConnAlive detects connections closed by carbon. Without this check
+// the first write after a carbon restart would succeed locally and be lost.
+func graphiteConnAlive(conn net.Conn) bool {
+	// An already expired deadline would fail without looking at the socket
+	conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var buf [1]byte
+	_, err := conn.Read(buf[:])
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// metrics flattens a sample into dotted paths below <prefix>.<hostname>.
+// Values of a core, device, interface or process contain it after the first
+// element, e.g. disk_io.sda.await_ms.
+func (s *graphiteSink) metrics(m SystemMetrics) []graphiteMetric {
+	base := graphitePathElement(m.Hostname)
+	if s.cfg.Prefix != "" {
+		base = strings.TrimSuffix(s.cfg.Prefix, ".") + "." + base
+	}
+
+	metric := func(name string, value float64) graphiteMetric {
+		return graphiteMetric{path: base + "." + name, value: value}
+	}
+
+	var metrics []graphiteMetric
+	for _, f := range flattenMetrics(m) {
+		metrics = append(metrics, metric(f.path(graphitePathElement), f.value))
+	}
+	return metrics
+}
+
+// graphitePathElement makes a value usable as a single path element, e.g.
+// "web01.example.com" becomes "web01_example_com".
+func graphitePathElement(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, value)
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+// graphitePlaintext formats metrics as "<path> <value> <timestamp>" lines.
+func graphitePlaintext(metrics []graphiteMetric, ts int64) []byte {
+	var buf bytes.Buffer
+	for _, metric := range metrics {
+		fmt.Fprintf(&buf, "%s %s %d\n", metric.path, strconv.FormatFloat(metric.value, 'f', -1, 64), ts)
+	}
+	return buf.Bytes()
+}
+
+// graphitePickle encodes metrics as length-prefixed pickle (protocol 2) of
+// [(path, (timestamp, value)), ...] as expected by carbon's pickle receiver.
+func graphitePickle(metrics []graphiteMetric, ts int64) []byte {
+	var p []byte
+	p = append(p, 0x80, 2)  // PROTO 2
+	p = append(p, ']', '(') // EMPTY_LIST, MARK
+	for _, metric := range metrics {
+		p = append(p, 'X') // BINUNICODE
+		p = binary.LittleEndian.AppendUint32(p, uint32(len(metric.path)))
+		p = append(p, metric.path...)
+		p = append(p, 'J') // BININT
+		p = binary.LittleEndian.AppendUint32(p, uint32(int32(ts)))
+		p = append(p, 'G') // BINFLOAT
+		p = binary.BigEndian.AppendUint64(p, math.Float64bits(metric.value))
+		p = append(p, 0x86, 0x86) // TUPLE2 (timestamp, value), TUPLE2 (path, ...)
+	}
+	p = append(p, 'e', '.') // APPENDS, STOP
+
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(p))), p...)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphitePickle(t *testing.T) {
+	metrics := []graphiteMetric{{path: "a.b", value: 1.5}}
+
+	// pickle.dumps([("a.b", (1700000000, 1.5))], protocol=2) as written by
+	// hand, checked with Python's pickle.loads
+	payload, _ := hex.DecodeString("80025d285803000000612e624a00f15365473ff80000000000008686652e")
+	want := append([]byte{0, 0, 0, byte(len(payload))}, payload...)
+
+	if got := graphitePickle(metrics, 1700000000); !bytes.Equal(got, want) {
+		t.Errorf("graphitePickle() =\n% x\nwant\n% x", got, want)
+	}
+}
+
+func TestGraphitePickleMultipleMetrics(t *testing.T) {
+	metrics := []graphiteMetric{{path: "a", value: 1}, {path: "b", value: 2}}
+	got := graphitePickle(metrics, 1)
+
+	if length := int(got[0])<<24 | int(got[1])<<16 | int(got[2])<<8 | int(got[3]); length != len(got)-4 {
+		t.Errorf("length prefix %d, payload %d bytes", length, len(got)-4)
+	}
+	// Both tuples are appended to the list with a single APPENDS
+	if !bytes.HasSuffix(got, []byte{0x86, 0x86, 'e', '.'}) || bytes.Count(got, []byte{'e', '.'}) != 1 {
+		t.Errorf("unexpected payload % x", got)
+	}
+}
+
+func TestGraphitePlaintext(t *testing.T) {
+	got := string(graphitePlaintext([]graphiteMetric{{path: "hosts.web01.cpu.percent", value: 12.5}}, 1700000000))
+	if want := "hosts.web01.cpu.percent 12.5 1700000000\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGraphitePathElement(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"web01.example.com", "web01_example_com"},
+		{"sda1", "sda1"},
+		{"/var/lib", "_var_lib"},
+		{"", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := graphitePathElement(tt.in); got != tt.want {
+			t.Errorf("graphitePathElement(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGraphiteSinkSendsPlaintext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		lines <- line
+	}()
+
+	sink := &graphiteSink{cfg: graphiteSinkConfig{
+		Address:  listener.Addr().String(),
+		Protocol: "plaintext",
+		Prefix:   "hosts",
+		Timeout:  jsonDuration(time.Second),
+	}}
+	defer sink.Close()
+
+	if err := sink.Send(SystemMetrics{Timestamp: "2026-10-17T06:15:00Z", Hostname: "web01", CPUPercent: 12.5}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case line := <-lines:
+		if !strings.HasPrefix(line, "hosts.web01.cpu.percent 12.5 1792217700") {
+			t.Errorf("first line = %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing received")
+	}
+}
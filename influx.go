@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// influxSinkConfig is the config.json representation of an InfluxDB sink.
+// A udp:// URL sends fire-and-forget datagrams, http(s):// URLs use the
+// v2 write API when a bucket is configured and the v1 API otherwise.
+type influxSinkConfig struct {
+	URL     string       `json:"url"`
+	Timeout jsonDuration `json:"timeout"`
+
+	// InfluxDB 2.x / VictoriaMetrics
+	Token  string `json:"token"`
+	Org    string `json:"org"`
+	Bucket string `json:"bucket"`
+
+	// InfluxDB 1.x
+	Database string `json:"database"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// UDP
+	MaxPacketSize int `json:"max_packet_size"`
+}
+
+// influxSink writes samples in InfluxDB line protocol.
+type influxSink struct {
+	cfg      influxSinkConfig
+	writeURL string
+	client   *http.Client
+	conn     net.Conn
+}
+
+func init() {
+	registerSink("influxdb", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := influxSinkConfig{
+			Timeout:       jsonDuration(10 * time.Second),
+			MaxPacketSize: 1432, // Ethernet MTU minus IP/UDP headers
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+		return newInfluxSink(cfg)
+	})
+}
+
+func newInfluxSink(cfg influxSinkConfig) (*influxSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &influxSink{cfg: cfg}
+
+	switch u.Scheme {
+	case "udp":
+		s.conn, err = net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+	case "http", "https":
+		query := url.Values{}
+		query.Set("precision", "s")
+		if cfg.Bucket != "" {
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+			query.Set("org", cfg.Org)
+			query.Set("bucket", cfg.Bucket)
+		} else {
+			if cfg.Database == "" {
+				return nil, errors.New("bucket oder database fehlt")
+			}
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/write"
+			query.Set("db", cfg.Database)
+		}
+		u.RawQuery = query.Encode()
+
+		s.writeURL = u.String()
+		s.client = &http.Client{Timeout: time.Duration(cfg.Timeout)}
+	default:
+		return nil, fmt.Errorf("nicht unterstütztes Schema %q", u.Scheme)
+	}
+
+	return s, nil
+}
+
+func (s *influxSink) Send(metrics SystemMetrics) error {
+	body := influxLines(metrics)
+
+	if s.conn != nil {
+		// Lines split across datagrams would be rejected as malformed
+		lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+		return writeDatagrams(s.conn, lines, s.cfg.MaxPacketSize)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.cfg.Token)
+	} else if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkHTTPResponse(resp)
+}
+
+func (s *influxSink) Flush() error {
+	return nil
+}
+
+func (s *influxSink) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+// influxLines converts a sample into line protocol with one measurement per
+// subsystem and the hostname as tag.
+func influxLines(m SystemMetrics) []byte {
+	var buf bytes.Buffer
+	// Empty tag values are not allowed in line protocol
+	var tags string
+	if m.Hostname != "" {
+		tags = ",host=" + influxEscape(m.Hostname)
+	}
+	ts := strconv.FormatInt(metricsTime(m).Unix(), 10)
+
+	writeTaggedLine := func(measurement, extraTags string, fields ...string) {
+		buf.WriteString(measurement)
+		buf.WriteString(tags)
+		buf.WriteString(extraTags)
+		buf.WriteByte(' ')
+		buf.WriteString(strings.Join(fields, ","))
+		buf.WriteByte(' ')
+		buf.WriteString(ts)
+		buf.WriteByte('\n')
+	}
+	writeLine := func(measurement string, fields ...string) {
+		writeTaggedLine(measurement, "", fields...)
+	}
+
+	cpuFields := []string{influxFloat("usage_percent", m.CPUPercent)}
+	if m.CPUModes != nil {
+		cpuFields = append(cpuFields, influxCPUModeFields(*m.CPUModes)...)
+	}
+	writeLine("cpu", cpuFields...)
+	for _, core := range m.CPUCores {
+		writeTaggedLine("cpu", ",cpu="+influxEscape(core.Core),
+			append([]string{influxFloat("usage_percent", core.Percent)}, influxCPUModeFields(core.CPUModes)...)...)
+	}
+	writeLine("system",
+		influxFloat("load1", m.LoadAverage1),
+		influxFloat("load5", m.LoadAverage5),
+		influxFloat("load15", m.LoadAverage15),
+		influxFloat("load1_per_cpu", m.LoadPerCPU1),
+		influxFloat("load5_per_cpu", m.LoadPerCPU5),
+		influxFloat("load15_per_cpu", m.LoadPerCPU15),
+		influxInt("procs_running", int64(m.ProcsRunning)),
+		influxInt("procs_blocked", int64(m.ProcsBlocked)),
+		influxInt("uptime", int64(m.UptimeSeconds)))
+	writeLine("mem",
+		influxFloat("used_percent", m.MemoryPercent),
+		influxFloat("used_mb", m.MemoryMB))
+	writeLine("disk",
+		influxFloat("used_percent", m.DiskPercent),
+		influxFloat("free_gb", m.DiskFreeGB))
+	for _, d := range m.Disks {
+		diskTags := ",path=" + influxEscape(d.Path)
+		if d.Device != "" {
+			diskTags += ",device=" + influxEscape(d.Device)
+		}
+		if d.FSType != "" {
+			diskTags += ",fstype=" + influxEscape(d.FSType)
+		}
+		writeTaggedLine("disk", diskTags,
+			influxFloat("used_percent", d.Percent),
+			influxInt("free", int64(d.FreeBytes)),
+			influxInt("used", int64(d.UsedBytes)),
+			influxInt("total", int64(d.TotalBytes)),
+			influxFloat("inodes_used_percent", d.InodesPercent),
+			influxInt("inodes_free", int64(d.InodesFree)),
+			influxInt("inodes_total", int64(d.InodesTotal)))
+	}
+	for _, d := range m.DiskIO {
+		writeTaggedLine("diskio", ",name="+influxEscape(d.Device),
+			influxInt("read_bytes_per_second", int64(d.ReadBPS)),
+			influxInt("write_bytes_per_second", int64(d.WriteBPS)),
+			influxFloat("reads_per_second", d.ReadIOPS),
+			influxFloat("writes_per_second", d.WriteIOPS),
+			influxFloat("await_ms", d.AwaitMS),
+			influxFloat("util_percent", d.UtilPercent))
+	}
+	// The total would be counted twice when summing up the series of net
+	if len(m.NetworkInterfaces) == 0 {
+		writeLine("net", influxNetFields(NetworkInterfaceUsage{
+			RXBPS:    m.NetworkRXBPS,
+			TXBPS:    m.NetworkTXBPS,
+			RXPPS:    m.NetworkRXPPS,
+			TXPPS:    m.NetworkTXPPS,
+			RXErrors: m.NetworkRXErrors,
+			TXErrors: m.NetworkTXErrors,
+			RXDrops:  m.NetworkRXDrops,
+			TXDrops:  m.NetworkTXDrops,
+		})...)
+	}
+	for _, iface := range m.NetworkInterfaces {
+		writeTaggedLine("net", ",interface="+influxEscape(iface.Interface), influxNetFields(iface)...)
+	}
+	tcpFields := []string{
+		influxInt("connections", int64(m.TCPConnections)),
+		influxInt("ipv4", int64(m.TCPIPv4)),
+		influxInt("ipv6", int64(m.TCPIPv6)),
+	}
+	for _, state := range sortedStateNames(m.TCPStates) {
+		tcpFields = append(tcpFields, influxInt(strings.ToLower(state), int64(m.TCPStates[state])))
+	}
+	writeLine("tcp", tcpFields...)
+	writeLine("udp",
+		influxInt("sockets", int64(m.UDPSockets)),
+		influxInt("ipv4", int64(m.UDPIPv4)),
+		influxInt("ipv6", int64(m.UDPIPv6)))
+	for _, port := range m.ListeningPorts {
+		portTags := ",protocol=" + port.Protocol
+		if port.Address != "" {
+			portTags += ",address=" + influxEscape(port.Address)
+		}
+		portTags += ",port=" + strconv.FormatUint(uint64(port.Port), 10)
+		if port.Process != "" {
+			portTags += ",process=" + influxEscape(port.Process)
+		}
+		writeTaggedLine("listening_port", portTags, influxInt("pid", int64(port.PID)))
+	}
+	writeLine("processes",
+		influxInt("not_running", int64(m.ProcessesNotRunningCount)))
+	for _, p := range m.Processes {
+		writeTaggedLine("procstat", ",process="+influxEscape(p.Name),
+			influxInt("instances", int64(p.Instances)),
+			influxFloat("cpu_percent", p.CPUPercent),
+			influxInt("rss_bytes", int64(p.RSSBytes)),
+			influxInt("threads", int64(p.Threads)),
+			influxInt("open_fds", int64(p.OpenFDs)),
+			influxInt("read_bytes_per_second", int64(p.ReadBPS)),
+			influxInt("write_bytes_per_second", int64(p.WriteBPS)),
+			influxInt("uptime", int64(p.UptimeSeconds)))
+	}
+	writeLine("ports",
+		influxInt("missing", int64(m.PortsMissingCount)))
+
+	return buf.Bytes()
+}
+
+func influxCPUModeFields(modes CPUModes) []string {
+	return []string{
+		influxFloat("usage_user", modes.User),
+		influxFloat("usage_nice", modes.Nice),
+		influxFloat("usage_system", modes.System),
+		influxFloat("usage_idle", modes.Idle),
+		influxFloat("usage_iowait", modes.IOWait),
+		influxFloat("usage_irq", modes.IRQ),
+		influxFloat("usage_softirq", modes.SoftIRQ),
+		influxFloat("usage_steal", modes.Steal),
+		influxFloat("usage_guest", modes.Guest),
+		influxFloat("usage_guest_nice", modes.GuestNice),
+	}
+}
+
+func influxNetFields(n NetworkInterfaceUsage) []string {
+	return []string{
+		influxInt("rx_bytes_per_second", int64(n.RXBPS)),
+		influxInt("tx_bytes_per_second", int64(n.TXBPS)),
+		influxFloat("rx_packets_per_second", n.RXPPS),
+		influxFloat("tx_packets_per_second", n.TXPPS),
+		influxInt("rx_errors", int64(n.RXErrors)),
+		influxInt("tx_errors", int64(n.TXErrors)),
+		influxInt("rx_drops", int64(n.RXDrops)),
+		influxInt("tx_drops", int64(n.TXDrops)),
+	}
+}
+
+func influxFloat(key string, value float64) string {
+	return influxEscape(key) + "=" + strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func influxInt(key string, value int64) string {
+	return influxEscape(key) + "=" + strconv.FormatInt(value, 10) + "i"
+}
+
+// influxEscape escapes measurement names, tag keys/values and field keys.
+func influxEscape(value string) string {
+	return strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `).Replace(value)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// influxRequest is a write request received by the HTTP stand-in.
+type influxRequest struct {
+	path, query string
+	header      http.Header
+	body        string
+}
+
+func newInfluxServer(t *testing.T, status int) (*httptest.Server, chan influxRequest) {
+	requests := make(chan influxRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- influxRequest{path: r.URL.Path, query: r.URL.RawQuery, header: r.Header, body: string(body)}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func testInfluxMetrics() SystemMetrics {
+	return SystemMetrics{
+		Timestamp:  "2026-10-17T06:15:00Z",
+		Hostname:   "web 01,dc=1",
+		CPUPercent: 12.5,
+		Processes:  []ProcessUsage{{Name: "my app", Instances: 2}},
+	}
+}
+
+func TestInfluxSinkV1Write(t *testing.T) {
+	server, requests := newInfluxServer(t, http.StatusNoContent)
+
+	sink, err := newInfluxSink(influxSinkConfig{
+		URL:      server.URL,
+		Database: "telegraf",
+		Username: "writer",
+		Password: "secret",
+		Timeout:  jsonDuration(time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Send(testInfluxMetrics()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	if req.path != "/write" || req.query != "db=telegraf&precision=s" {
+		t.Errorf("request to %s?%s", req.path, req.query)
+	}
+	if user, pass, ok := (&http.Request{Header: req.header}).BasicAuth(); !ok || user != "writer" || pass != "secret" {
+		t.Errorf("basic auth = %q, %q, %t", user, pass, ok)
+	}
+	if ct := req.header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.HasPrefix(req.body, `cpu,host=web\ 01\,dc\=1 usage_percent=12.5 1792217700`+"\n") {
+		t.Errorf("body starts with %q", strings.SplitN(req.body, "\n", 2)[0])
+	}
+}
+
+func TestInfluxSinkV2Write(t *testing.T) {
+	server, requests := newInfluxServer(t, http.StatusNoContent)
+
+	sink, err := newInfluxSink(influxSinkConfig{
+		URL:     server.URL + "/",
+		Token:   "token123",
+		Org:     "ops",
+		Bucket:  "hosts",
+		Timeout: jsonDuration(time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Send(testInfluxMetrics()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	if req.path != "/api/v2/write" || req.query != "bucket=hosts&org=ops&precision=s" {
+		t.Errorf("request to %s?%s", req.path, req.query)
+	}
+	if auth := req.header.Get("Authorization"); auth != "Token token123" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if !strings.Contains(req.body, "\n"+`procstat,host=web\ 01\,dc\=1,process=my\ app instances=2i,`) {
+		t.Errorf("procstat line missing in\n%s", req.body)
+	}
+}
+
+func TestInfluxSinkReportsRejectedWrites(t *testing.T) {
+	server, requests := newInfluxServer(t, http.StatusBadRequest)
+
+	sink, err := newInfluxSink(influxSinkConfig{URL: server.URL, Database: "telegraf", Timeout: jsonDuration(time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Send(testInfluxMetrics()); err == nil {
+		t.Error("no error for HTTP 400")
+	}
+	<-requests
+}
+
+func TestInfluxSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := newInfluxSink(influxSinkConfig{URL: "udp://" + conn.LocalAddr().String(), MaxPacketSize: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	m := testInfluxMetrics()
+	want := strings.Split(strings.TrimSuffix(string(influxLines(m)), "\n"), "\n")
+	if err := sink.Send(m); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every datagram stays within the limit and contains only whole lines
+	var lines []string
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(lines) < len(want) {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("after %d of %d lines: %v", len(lines), len(want), err)
+		}
+		if n > 300 {
+			t.Errorf("datagram of %d bytes exceeds max_packet_size", n)
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	if !slices.Equal(lines, want) {
+		t.Errorf("received lines\n%q\nwant\n%q", lines, want)
+	}
+
+	if lines[0] != `cpu,host=web\ 01\,dc\=1 usage_percent=12.5 1792217700` {
+		t.Errorf("first line = %q", lines[0])
+	}
+	for _, line := range lines {
+		// measurement+tags, fields and timestamp separated by unescaped spaces
+		if fields := strings.Fields(strings.ReplaceAll(line, `\ `, "_")); len(fields) != 3 {
+			t.Errorf("malformed line %q", line)
+		}
+	}
+}
+
+func TestInfluxEscape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"web01", "web01"},
+		{"my host", `my\ host`},
+		{"a,b=c", `a\,b\=c`},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := influxEscape(tt.in); got != tt.want {
+			t.Errorf("influxEscape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInfluxLinesNetworkPerInterface(t *testing.T) {
+	m := SystemMetrics{Hostname: "web01", NetworkRXBPS: 300}
+	if body := string(influxLines(m)); !strings.Contains(body, "\nnet,host=web01 rx_bytes_per_second=300i,") {
+		t.Errorf("net line missing in\n%s", body)
+	}
+
+	// The interfaces replace the total, which would be counted twice otherwise
+	m.NetworkInterfaces = []NetworkInterfaceUsage{{Interface: "eth0", RXBPS: 100}, {Interface: "eth1", RXBPS: 200}}
+	body := string(influxLines(m))
+	if strings.Contains(body, "\nnet,host=web01 ") {
+		t.Errorf("untagged net line next to the interfaces in\n%s", body)
+	}
+	if strings.Count(body, "\nnet,host=web01,interface=") != 2 {
+		t.Errorf("want one net line per interface in\n%s", body)
+	}
+}
+
+func TestInfluxLinesOmitsEmptyTags(t *testing.T) {
+	m := SystemMetrics{
+		Timestamp:      "2026-10-17T06:15:00Z",
+		ListeningPorts: []ListeningPort{{Protocol: "tcp", Port: 22}, {Protocol: "udp", Address: "::", Port: 53, Process: "dnsmasq"}},
+	}
+	lines := strings.Split(strings.TrimSuffix(string(influxLines(m)), "\n"), "\n")
+
+	want := []string{
+		"listening_port,protocol=tcp,port=22 pid=0i 1792217700",
+		"listening_port,protocol=udp,address=::,port=53,process=dnsmasq pid=0i 1792217700",
+	}
+	for _, line := range want {
+		if !slices.Contains(lines, line) {
+			t.Errorf("missing %q", line)
+		}
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "=,") || strings.Contains(line, "= ") || strings.Contains(line, "host=") {
+			t.Errorf("empty tag in %q", line)
+		}
+	}
+}
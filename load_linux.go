@@ -0,0 +1,86 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// getLoadStats reads load average, run queue and uptime from /proc.
+func getLoadStats() LoadStats {
+	var stats LoadStats
+	if data, err := readProcFile("loadavg"); err == nil {
+		parseLoadavg(bytes.NewReader(data), &stats)
+	}
+	if data, err := readProcFile("stat"); err == nil {
+		parseProcStat(bytes.NewReader(data), &stats)
+	}
+	if stats.CPUCount == 0 {
+		stats.CPUCount = runtime.NumCPU()
+	}
+	if data, err := readProcFile("uptime"); err == nil {
+		parseUptime(bytes.NewReader(data), &stats)
+	}
+	return stats
+}
+
+// parseLoadavg reads the load averages from /proc/loadavg,
+// e.g. "0.42 0.37 0.30 2/512 12345".
+func parseLoadavg(r io.Reader, stats *LoadStats) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	fields := bytes.Fields(data)
+	if len(fields) >= 3 {
+		stats.Load1, _ = strconv.ParseFloat(string(fields[0]), 64)
+		stats.Load5, _ = strconv.ParseFloat(string(fields[1]), 64)
+		stats.Load15, _ = strconv.ParseFloat(string(fields[2]), 64)
+	}
+}
+
+// parseProcStat reads the run queue, boot time and number of cores from
+// /proc/stat.
+func parseProcStat(r io.Reader, stats *LoadStats) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch key := string(fields[0]); {
+		case key == "procs_running":
+			stats.ProcsRunning, _ = strconv.Atoi(string(fields[1]))
+		case key == "procs_blocked":
+			stats.ProcsBlocked, _ = strconv.Atoi(string(fields[1]))
+		case key == "btime":
+			if btime, err := strconv.ParseInt(string(fields[1]), 10, 64); err == nil {
+				stats.BootTime = time.Unix(btime, 0)
+			}
+		case len(key) > 3 && key[:3] == "cpu":
+			// Count the host's cores instead of the CPUs available to
+			// this process, which may be limited inside a container
+			stats.CPUCount++
+		}
+	}
+}
+
+// parseUptime reads the uptime from /proc/uptime, e.g. "12345.67 23456.78".
+func parseUptime(r io.Reader, stats *LoadStats) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	fields := bytes.Fields(data)
+	if len(fields) >= 1 {
+		if seconds, err := strconv.ParseFloat(string(fields[0]), 64); err == nil {
+			stats.Uptime = time.Duration(seconds * float64(time.Second))
+		}
+	}
+}
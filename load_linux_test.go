@@ -0,0 +1,62 @@
+//go:build linux
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLoadavg(t *testing.T) {
+	var stats LoadStats
+	parseLoadavg(strings.NewReader("0.42 1.37 12.30 2/512 12345\n"), &stats)
+	if stats.Load1 != 0.42 || stats.Load5 != 1.37 || stats.Load15 != 12.30 {
+		t.Errorf("load = %v %v %v", stats.Load1, stats.Load5, stats.Load15)
+	}
+
+	stats = LoadStats{}
+	parseLoadavg(strings.NewReader("0.42 1.37\n"), &stats)
+	if stats != (LoadStats{}) {
+		t.Errorf("truncated file: %+v", stats)
+	}
+}
+
+func TestParseProcStat(t *testing.T) {
+	const stat = `cpu  4705 356 584 3699 23 23 0 0 0 0
+cpu0 1393 280 213 1816 11 14 0 0 0 0
+cpu1 1302 26 138 1883 12 9 0 0 0 0
+intr 114930 27 9 0 0 0 0 3 0 1 0
+ctxt 1990473
+btime 1062191376
+processes 2915
+procs_running 3
+procs_blocked 1
+softirq 183433 0 21755 12 39 1137 231 21459 2263
+`
+	var stats LoadStats
+	parseProcStat(strings.NewReader(stat), &stats)
+	if stats.ProcsRunning != 3 || stats.ProcsBlocked != 1 {
+		t.Errorf("procs running/blocked = %d/%d, want 3/1", stats.ProcsRunning, stats.ProcsBlocked)
+	}
+	if stats.CPUCount != 2 {
+		t.Errorf("cpu count = %d, want 2", stats.CPUCount)
+	}
+	if !stats.BootTime.Equal(time.Unix(1062191376, 0)) {
+		t.Errorf("boot time = %v", stats.BootTime)
+	}
+
+	stats = LoadStats{}
+	parseProcStat(strings.NewReader("procs_running\nprocs_blocked x\n"), &stats)
+	if stats.ProcsRunning != 0 || stats.ProcsBlocked != 0 {
+		t.Errorf("malformed lines: %+v", stats)
+	}
+}
+
+func TestParseUptime(t *testing.T) {
+	var stats LoadStats
+	parseUptime(strings.NewReader("12345.67 23456.78\n"), &stats)
+	if want := 12345670 * time.Millisecond; stats.Uptime != want {
+		t.Errorf("uptime = %v, want %v", stats.Uptime, want)
+	}
+}
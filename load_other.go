@@ -0,0 +1,36 @@
+//go:build !linux
+
+package main
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+)
+
+// getLoadStats uses gopsutil on platforms without /proc. Windows has no
+// native load average, gopsutil approximates it from the processor queue
+// length after the first call.
+func getLoadStats() LoadStats {
+	stats := LoadStats{CPUCount: runtime.NumCPU()}
+
+	if avg, err := load.Avg(); err == nil {
+		stats.Load1 = avg.Load1
+		stats.Load5 = avg.Load5
+		stats.Load15 = avg.Load15
+	}
+
+	if misc, err := load.Misc(); err == nil {
+		stats.ProcsRunning = misc.ProcsRunning
+		stats.ProcsBlocked = misc.ProcsBlocked
+	}
+
+	if bootTime, err := host.BootTime(); err == nil {
+		stats.BootTime = time.Unix(int64(bootTime), 0)
+		stats.Uptime = time.Since(stats.BootTime)
+	}
+
+	return stats
+}
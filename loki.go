@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	lokiRetryMinBackoff = 1 * time.Second
+	lokiRetryMaxBackoff = 5 * time.Minute
+
+	// Loki's default grpc_server_max_recv_msg_size is 4 MB
+	lokiBatchMaxBytes = 1024 * 1024
+)
+
+// lokiSinkConfig is the config.json representation of a Loki sink.
+type lokiSinkConfig struct {
+	URL      string            `json:"url"`
+	Encoding string            `json:"encoding"` // "json" or "protobuf"
+	Labels   map[string]string `json:"labels"`   // added to the host, application and job labels
+	TenantID string            `json:"tenant_id"`
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	Timeout  jsonDuration      `json:"timeout"`
+
+	BatchSize     int          `json:"batch_size"`
+	FlushInterval jsonDuration `json:"flush_interval"`
+
+	spoolConfig
+}
+
+// lokiSink pushes every sample as CLEF JSON log line to Loki. Lines are
+// batched and grouped into one stream per label set.
+type lokiSink struct {
+	cfg     lokiSinkConfig
+	pushURL string
+	client  *http.Client
+	batches *batcher
+}
+
+// lokiEntry is the batched record of a single log line.
+type lokiEntry struct {
+	Labels map[string]string `json:"labels"`
+	Time   int64             `json:"ts"` // Unix nanoseconds
+	Line   string            `json:"line"`
+}
+
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+func init() {
+	registerSink("loki", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := lokiSinkConfig{
+			URL:       "http://localhost:3100",
+			Encoding:  "json",
+			Timeout:   jsonDuration(30 * time.Second),
+			BatchSize: 100,
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Encoding != "json" && cfg.Encoding != "protobuf" {
+			return nil, fmt.Errorf("unbekanntes Encoding %q", cfg.Encoding)
+		}
+
+		// Like for webhooks the spool is opt-in
+		if cfg.SpoolMaxSize == nil {
+			cfg.SpoolMaxSize = new(int)
+		}
+		sp, err := cfg.openSpool(name, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		s := &lokiSink{
+			cfg:     cfg,
+			pushURL: strings.TrimSuffix(cfg.URL, "/") + "/loki/api/v1/push",
+			client:  &http.Client{Timeout: time.Duration(cfg.Timeout)},
+		}
+		queue := newDeliveryQueue(name, s.push, sp, retryPolicy{
+			MinBackoff: lokiRetryMinBackoff,
+			MaxBackoff: lokiRetryMaxBackoff,
+		})
+		s.batches = newBatcher(queue, cfg.BatchSize, lokiBatchMaxBytes, time.Duration(cfg.FlushInterval))
+
+		return s, nil
+	})
+}
+
+func (s *lokiSink) Send(metrics SystemMetrics) error {
+	line, err := json.Marshal(metrics)
+	if err != nil {
+		return fmt.Errorf("JSON-Encoding: %w", err)
+	}
+
+	labels := map[string]string{
+		"job":         "host-monitor",
+		"host":        metrics.Hostname,
+		"application": metrics.Application,
+	}
+	for key, value := range s.cfg.Labels {
+		labels[key] = value
+	}
+
+	record, err := json.Marshal(lokiEntry{
+		Labels: labels,
+		Time:   metricsTime(metrics).UnixNano(),
+		Line:   string(line),
+	})
+	if err != nil {
+		return err
+	}
+	return s.batches.Add(record)
+}
+
+func (s *lokiSink) Flush() error {
+	return s.batches.Flush()
+}
+
+func (s *lokiSink) Close() error {
+	return s.batches.Close()
+}
+
+func (s *lokiSink) push(records [][]byte) error {
+	streams, err := lokiStreams(records)
+	if err != nil {
+		return &permanentDeliveryError{err}
+	}
+
+	var body []byte
+	var contentType string
+	if s.cfg.Encoding == "protobuf" {
+		body = snappy.Encode(nil, lokiMarshalProto(streams))
+		contentType = "application/x-protobuf"
+	} else {
+		body, err = lokiMarshalJSON(streams)
+		if err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.pushURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", s.cfg.TenantID)
+	}
+	if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkHTTPResponse(resp)
+}
+
+// lokiStreams groups the batched entries by label set, keeping their order.
+func lokiStreams(records [][]byte) ([]*lokiStream, error) {
+	var streams []*lokiStream
+	byKey := make(map[string]*lokiStream)
+
+	for _, record := range records {
+		var entry lokiEntry
+		if err := json.Unmarshal(record, &entry); err != nil {
+			return nil, errors.New("ungültiger Datensatz")
+		}
+
+		key := lokiLabelString(entry.Labels)
+		stream, ok := byKey[key]
+		if !ok {
+			stream = &lokiStream{labels: entry.Labels}
+			byKey[key] = stream
+			streams = append(streams, stream)
+		}
+		stream.entries = append(stream.entries, entry)
+	}
+
+	return streams, nil
+}
+
+func lokiMarshalJSON(streams []*lokiStream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	request := struct {
+		Streams []jsonStream `json:"streams"`
+	}{}
+	for _, stream := range streams {
+		js := jsonStream{Stream: stream.labels}
+		for _, entry := range stream.entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(entry.Time, 10), entry.Line})
+		}
+		request.Streams = append(request.Streams, js)
+	}
+
+	return json.Marshal(request)
+}
+
+// lokiMarshalProto encodes a logproto.PushRequest.
+func lokiMarshalProto(streams []*lokiStream) []byte {
+	var b []byte
+	for _, stream := range streams {
+		s := protoAppendString(nil, 1, lokiLabelString(stream.labels))
+		for _, entry := range stream.entries {
+			ts := protoAppendVarint(nil, 1, uint64(entry.Time/int64(time.Second)))
+			ts = protoAppendVarint(ts, 2, uint64(entry.Time%int64(time.Second)))
+
+			e := protoAppendMessage(nil, 1, ts)
+			e = protoAppendString(e, 2, entry.Line)
+			s = protoAppendMessage(s, 2, e)
+		}
+		b = protoAppendMessage(b, 1, s)
+	}
+	return b
+}
+
+// lokiLabelString formats labels in Prometheus notation, e.g.
+// {host="web01", job="host-monitor"}, with the keys sorted.
+func lokiLabelString(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + strconv.Quote(labels[key])
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
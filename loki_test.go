@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+type lokiRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newLokiServer(t *testing.T) (*httptest.Server, chan lokiRequest) {
+	requests := make(chan lokiRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			t.Errorf("request to %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests <- lokiRequest{header: r.Header, body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func lokiTestRecords(t *testing.T, entries ...lokiEntry) [][]byte {
+	var records [][]byte
+	for _, entry := range entries {
+		record, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLokiPushProtobuf(t *testing.T) {
+	server, requests := newLokiServer(t)
+	s := &lokiSink{
+		cfg:     lokiSinkConfig{Encoding: "protobuf", TenantID: "team-a"},
+		pushURL: server.URL + "/loki/api/v1/push",
+		client:  server.Client(),
+	}
+
+	records := lokiTestRecords(t, lokiEntry{Labels: map[string]string{"a": "b"}, Time: 1_000_000_005, Line: "x"})
+	if err := s.push(records); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	if ct := req.header.Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if tenant := req.header.Get("X-Scope-OrgID"); tenant != "team-a" {
+		t.Errorf("X-Scope-OrgID = %q", tenant)
+	}
+
+	body, err := snappy.Decode(nil, req.body)
+	if err != nil {
+		t.Fatalf("body is no snappy block: %v", err)
+	}
+
+	// logproto.PushRequest as defined in pkg/push/push.proto
+	var want []byte
+	want = append(want, 0x0a, 0x14)             // PushRequest.streams = 1
+	want = append(want, 0x0a, 0x07)             // StreamAdapter.labels = 1
+	want = append(want, `{a="b"}`...)           //
+	want = append(want, 0x12, 0x09)             // StreamAdapter.entries = 2
+	want = append(want, 0x0a, 0x04)             // EntryAdapter.timestamp = 1
+	want = append(want, 0x08, 0x01, 0x10, 0x05) // Timestamp.seconds = 1, nanos = 2
+	want = append(want, 0x12, 0x01, 'x')        // EntryAdapter.line = 2
+	if !bytes.Equal(body, want) {
+		t.Errorf("PushRequest =\n% x\nwant\n% x", body, want)
+	}
+}
+
+func TestLokiPushJSON(t *testing.T) {
+	server, requests := newLokiServer(t)
+	s := &lokiSink{
+		cfg:     lokiSinkConfig{Encoding: "json"},
+		pushURL: server.URL + "/loki/api/v1/push",
+		client:  server.Client(),
+	}
+
+	web01 := map[string]string{"host": "web01"}
+	web02 := map[string]string{"host": "web02"}
+	records := lokiTestRecords(t,
+		lokiEntry{Labels: web01, Time: 1, Line: "a"},
+		lokiEntry{Labels: web02, Time: 2, Line: "b"},
+		lokiEntry{Labels: web01, Time: 3, Line: "c"},
+	)
+	if err := s.push(records); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	want := `{"streams":[{"stream":{"host":"web01"},"values":[["1","a"],["3","c"]]},{"stream":{"host":"web02"},"values":[["2","b"]]}]}`
+	if string(req.body) != want {
+		t.Errorf("body = %s\nwant %s", req.body, want)
+	}
+}
+
+func TestLokiSnappyRoundTrip(t *testing.T) {
+	line, _ := json.Marshal(SystemMetrics{Hostname: "web01", Application: "HostMonitor"})
+	streams := []*lokiStream{{labels: map[string]string{"host": "web01"}}}
+	for i := 0; i < 100; i++ {
+		streams[0].entries = append(streams[0].entries, lokiEntry{Time: int64(i), Line: string(line)})
+	}
+
+	payload := lokiMarshalProto(streams)
+	decoded, err := snappy.Decode(nil, snappy.Encode(nil, payload))
+	if err != nil || !bytes.Equal(decoded, payload) {
+		t.Errorf("round trip failed: %v", err)
+	}
+}
+
+func TestLokiLabelString(t *testing.T) {
+	got := lokiLabelString(map[string]string{"job": "host-monitor", "host": `we"b`})
+	if want := `{host="we\"b", job="host-monitor"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
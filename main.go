@@ -1,74 +1,214 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/mem"
-	"github.com/shirou/gopsutil/v3/net"
-	"github.com/shirou/gopsutil/v3/process"
 )
 
 type SystemMetrics struct {
-	Timestamp                string   `json:"@t"`
-	MessageTemplate          string   `json:"@mt"`
-	Application              string   `json:"Application"`
-	Hostname                 string   `json:"Hostname"`
-	CPUPercent               float64  `json:"CPU_Percent"`
-	MemoryPercent            float64  `json:"Memory_Percent"`
-	MemoryMB                 float64  `json:"Memory_MB"`
-	DiskPercent              float64  `json:"Disk_Percent"`
-	DiskFreeGB               float64  `json:"Disk_Free_GB"`
-	NetworkRXBPS             uint64   `json:"Network_RX_BPS"`
-	NetworkTXBPS             uint64   `json:"Network_TX_BPS"`
-	TCPConnections           int      `json:"TCP_Connections"`
-	ProcessesNotRunningCount int      `json:"Processes_Not_Running_Count"`
-	ProcessesNotRunning      []string `json:"Processes_Not_Running,omitempty"`
+	Timestamp                string                  `json:"@t"`
+	MessageTemplate          string                  `json:"@mt"`
+	Application              string                  `json:"Application"`
+	Hostname                 string                  `json:"Hostname"`
+	CPUPercent               float64                 `json:"CPU_Percent"`
+	MemoryPercent            float64                 `json:"Memory_Percent"`
+	MemoryMB                 float64                 `json:"Memory_MB"`
+	DiskPercent              float64                 `json:"Disk_Percent"`
+	DiskFreeGB               float64                 `json:"Disk_Free_GB"`
+	Disks                    []DiskUsage             `json:"Disks,omitempty"`
+	DiskIO                   []DiskIOUsage           `json:"Disk_IO,omitempty"`
+	NetworkRXBPS             uint64                  `json:"Network_RX_BPS"`
+	NetworkTXBPS             uint64                  `json:"Network_TX_BPS"`
+	NetworkRXPPS             float64                 `json:"Network_RX_PPS"`
+	NetworkTXPPS             float64                 `json:"Network_TX_PPS"`
+	NetworkRXErrors          uint64                  `json:"Network_RX_Errors"`
+	NetworkTXErrors          uint64                  `json:"Network_TX_Errors"`
+	NetworkRXDrops           uint64                  `json:"Network_RX_Drops"`
+	NetworkTXDrops           uint64                  `json:"Network_TX_Drops"`
+	NetworkInterfaces        []NetworkInterfaceUsage `json:"Network_Interfaces,omitempty"`
+	TCPConnections           int                     `json:"TCP_Connections"`
+	TCPIPv4                  int                     `json:"TCP_IPv4"`
+	TCPIPv6                  int                     `json:"TCP_IPv6"`
+	TCPStates                map[string]int          `json:"TCP_States,omitempty"`
+	UDPSockets               int                     `json:"UDP_Sockets"`
+	UDPIPv4                  int                     `json:"UDP_IPv4"`
+	UDPIPv6                  int                     `json:"UDP_IPv6"`
+	ListeningPorts           []ListeningPort         `json:"Listening_Ports,omitempty"`
+	ProcessesNotRunningCount int                     `json:"Processes_Not_Running_Count"`
+	ProcessesNotRunning      []string                `json:"Processes_Not_Running,omitempty"`
+	ProcessViolations        []string                `json:"Processes_Instance_Violations,omitempty"`
+	Processes                []ProcessUsage          `json:"Processes,omitempty"`
+	PortsMissingCount        int                     `json:"Ports_Missing_Count"`
+	PortsMissing             []string                `json:"Ports_Missing,omitempty"`
+	LoadAverage1             float64                 `json:"Load_Average_1"`
+	LoadAverage5             float64                 `json:"Load_Average_5"`
+	LoadAverage15            float64                 `json:"Load_Average_15"`
+	LoadPerCPU1              float64                 `json:"Load_Per_CPU_1"`
+	LoadPerCPU5              float64                 `json:"Load_Per_CPU_5"`
+	LoadPerCPU15             float64                 `json:"Load_Per_CPU_15"`
+	ProcsRunning             int                     `json:"Procs_Running"`
+	ProcsBlocked             int                     `json:"Procs_Blocked"`
+	BootTime                 string                  `json:"Boot_Time,omitempty"`
+	UptimeSeconds            uint64                  `json:"Uptime_Seconds"`
+
+	// Seconds since the previous sample the rates and counts refer to
+	IntervalSeconds float64 `json:"Interval_Seconds"`
+
+	// Linux only
+	CPUModes *CPUModes      `json:"CPU_Modes,omitempty"`
+	CPUCores []CPUCoreUsage `json:"CPU_Cores,omitempty"`
 }
 
-type NetworkStats struct {
-	RXBytes uint64
-	TXBytes uint64
+// CPUModes is the share of CPU time spent in each mode in percent. Guest
+// time is also contained in User and GuestNice in Nice.
+type CPUModes struct {
+	User      float64 `json:"User"`
+	Nice      float64 `json:"Nice"`
+	System    float64 `json:"System"`
+	Idle      float64 `json:"Idle"`
+	IOWait    float64 `json:"IOWait"`
+	IRQ       float64 `json:"IRQ"`
+	SoftIRQ   float64 `json:"SoftIRQ"`
+	Steal     float64 `json:"Steal"`
+	Guest     float64 `json:"Guest"`
+	GuestNice float64 `json:"GuestNice"`
+}
+
+// cpuModeValue is the share of one CPU mode with its lower-case name.
+type cpuModeValue struct {
+	mode  string
+	value float64
+}
+
+// values lists the modes in the order of /proc/stat.
+func (m CPUModes) values() []cpuModeValue {
+	return []cpuModeValue{
+		{"user", m.User},
+		{"nice", m.Nice},
+		{"system", m.System},
+		{"idle", m.Idle},
+		{"iowait", m.IOWait},
+		{"irq", m.IRQ},
+		{"softirq", m.SoftIRQ},
+		{"steal", m.Steal},
+		{"guest", m.Guest},
+		{"guest_nice", m.GuestNice},
+	}
+}
+
+type CPUCoreUsage struct {
+	Core    string  `json:"Core"`
+	Percent float64 `json:"Percent"`
+	CPUModes
 }
 
 type CPUStats struct {
 	IdleTime  uint64 // in nanoseconds
 	TotalTime uint64 // in nanoseconds
+
+	// Per-mode times in total and per core, Linux only
+	Modes *CPUTimes
+	Cores []CPUTimes
+}
+
+// LoadStats holds load average, run queue and uptime of the host.
+type LoadStats struct {
+	Load1, Load5, Load15       float64
+	CPUCount                   int
+	ProcsRunning, ProcsBlocked int // Linux and BSD only
+	BootTime                   time.Time
+	Uptime                     time.Duration
+}
+
+// CPUTimes are the cumulative times of one /proc/stat cpu line in nanoseconds.
+type CPUTimes struct {
+	Name                                                  string
+	User, Nice, System, Idle, IOWait, IRQ, SoftIRQ, Steal uint64
+	Guest, GuestNice                                      uint64 // already contained in User and Nice
+}
+
+// Total returns the overall time without counting guest time twice.
+func (t CPUTimes) Total() uint64 {
+	return t.User + t.Nice + t.System + t.Idle + t.IOWait + t.IRQ + t.SoftIRQ + t.Steal
 }
 
 type Config struct {
-	Disk      string   `json:"disk"`
-	Processes []string `json:"processes"`
+	Disk          string               `json:"disk"`
+	Disks         []string             `json:"disks"`
+	DiskDiscovery *diskDiscoveryConfig `json:"disk_discovery"`
+	DiskIO        *diskIOConfig        `json:"disk_io"`
+	Sockets       *socketsConfig       `json:"sockets"`
+	Network       *networkConfig       `json:"network"`
+	Processes     []ProcessCheck       `json:"processes"`
+	Ports         []PortCheck          `json:"ports"`
+	Sinks         []SinkConfig         `json:"sinks"`
+}
+
+// jsonDuration is a time.Duration that is written as "15s" in config.json
+type jsonDuration time.Duration
+
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = jsonDuration(parsed)
+	return nil
 }
 
 type ProcessCheckResult struct {
-	NotRunningCount int
-	NotRunning      []string
+	NotRunningCount    int
+	NotRunning         []string
+	InstanceViolations []string
 }
 
 func main() {
 	// Command line flags
 	debug := flag.Bool("debug", false, "Enable debug mode")
 	flag.BoolVar(debug, "d", false, "Enable debug mode (shorthand)")
-	seqURL := flag.String("seq-url", getEnvWithDefault("SEQ_URL", "http://seq:5341"), "Seq server URL")
-
-	intervalDefault := getEnvWithDefault("INTERVAL", "15s")
-	intervalParsed, err := time.ParseDuration(intervalDefault)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Fehler beim Parsen der INTERVAL-Umgebungsvariable: %v\n", err)
-		intervalParsed = 15 * time.Second
-	}
-	interval := flag.Duration("interval", intervalParsed, "Monitoring interval")
+	seqURL := flag.String("seq-url", getEnvWithDefault("SEQ_URL", "http://seq:5341"), "Seq server URL (empty disables sending to Seq)")
+	listenAddr := flag.String("listen", getEnvWithDefault("LISTEN", ""), "Address for serving Prometheus metrics on /metrics, e.g. :9100")
+	interval := flag.Duration("interval", getEnvDurationWithDefault("INTERVAL", 15*time.Second), "Monitoring interval")
+
+	// Seq delivery flags
+	seqBatchSize := flag.Int("seq-batch-size", getEnvIntWithDefault("SEQ_BATCH_SIZE", 100), "Maximum number of events per Seq request")
+	seqFlushInterval := flag.Duration("seq-flush-interval", getEnvDurationWithDefault("SEQ_FLUSH_INTERVAL", 0), "Collect events and send them to Seq at this interval (0 sends every event immediately)")
+	seqGzip := flag.Bool("seq-gzip", getEnvBoolWithDefault("SEQ_GZIP", false), "Compress Seq requests with gzip")
+	seqAPIKey := flag.String("seq-api-key", getEnvWithDefault("SEQ_API_KEY", ""), "Seq API key")
+	seqAPIKeyFile := flag.String("seq-api-key-file", getEnvWithDefault("SEQ_API_KEY_FILE", ""), "File containing the Seq API key")
+	seqCACert := flag.String("seq-ca-cert", getEnvWithDefault("SEQ_CA_CERT", ""), "PEM CA bundle for verifying the Seq server")
+	seqClientCert := flag.String("seq-client-cert", getEnvWithDefault("SEQ_CLIENT_CERT", ""), "PEM client certificate for mutual TLS")
+	seqClientKey := flag.String("seq-client-key", getEnvWithDefault("SEQ_CLIENT_KEY", ""), "PEM client key for mutual TLS")
+	seqTimeout := flag.Duration("seq-timeout", getEnvDurationWithDefault("SEQ_TIMEOUT", 30*time.Second), "Timeout for Seq requests")
+
+	// Spool flags
+	spoolDir := flag.String("spool-dir", getEnvWithDefault("SPOOL_DIR", ""), "Directory for buffering undelivered events (default: spool next to the executable)")
+	spoolMaxSize := flag.Int("spool-max-size", getEnvIntWithDefault("SPOOL_MAX_SIZE", 100), "Maximum spool size in MB (0 disables the spool)")
+	spoolMaxAge := flag.Duration("spool-max-age", getEnvDurationWithDefault("SPOOL_MAX_AGE", 7*24*time.Hour), "Maximum age of buffered events")
+
+	// File output flags
+	filePath := flag.String("file-path", getEnvWithDefault("FILE_PATH", ""), "Write every sample as CLEF/JSON line to this file")
+	fileMaxSize := flag.Int("file-max-size", getEnvIntWithDefault("FILE_MAX_SIZE", fileDefaultMaxSizeMB), "Rotate the output file at this size in MB (0 disables)")
+	fileRotateInterval := flag.Duration("file-rotate-interval", getEnvDurationWithDefault("FILE_ROTATE_INTERVAL", fileDefaultRotateInterval), "Rotate the output file at multiples of this interval (0 disables)")
+	fileMaxFiles := flag.Int("file-max-files", getEnvIntWithDefault("FILE_MAX_FILES", fileDefaultMaxFiles), "Number of rotated files to keep (0 keeps all)")
+	fileCompress := flag.Bool("file-compress", getEnvBoolWithDefault("FILE_COMPRESS", false), "Compress rotated files with gzip")
 
 	// Windows service flags
 	installService := flag.Bool("install", false, "Install as Windows service")
@@ -77,44 +217,142 @@ func main() {
 
 	flag.Parse()
 
+	// Load configuration if available
+	config := loadConfig()
+
+	// The default Seq server is only used when config.json configures no
+	// sinks, otherwise it would run next to them against a host that
+	// usually does not exist
+	if _, fromEnv := os.LookupEnv("SEQ_URL"); !fromEnv && !isFlagSet("seq-url") && config != nil && len(config.Sinks) > 0 {
+		*seqURL = ""
+	}
+
 	// Handle Windows service installation/uninstallation
 	if runtime.GOOS == "windows" {
 		if *installService {
-			if *seqURL == "" {
-				fmt.Fprintf(os.Stderr, "Fehler: Seq-URL ist verpflichtend für Service-Installation. Verwenden Sie --seq-url.\n")
+			if isFlagSet("seq-api-key") {
+				fmt.Fprintf(os.Stderr, "Fehler: --seq-api-key wäre in der Kommandozeile des Service für alle Benutzer lesbar. Verwenden Sie --seq-api-key-file.\n")
 				os.Exit(1)
 			}
-			installWindowsService(*serviceName, *seqURL, *interval, *debug)
+			if *seqURL == "" && *listenAddr == "" && *filePath == "" && (config == nil || len(config.Sinks) == 0) {
+				fmt.Fprintf(os.Stderr, "Fehler: Mindestens eine Ausgabe ist verpflichtend für Service-Installation. Verwenden Sie --seq-url, --listen, --file-path oder sinks in der config.json.\n")
+				os.Exit(1)
+			}
+			installWindowsService(*serviceName, *seqURL, *interval, *debug, forwardedServiceArgs())
 			return
 		}
 		if *uninstallService {
 			uninstallWindowsService(*serviceName)
 			return
 		}
+	}
 
-		// Check if running as Windows service
-		if isWindowsService() {
-			runAsWindowsService(*debug, *seqURL, *interval)
-			return
+	// Set up outputs from command line flags and config.json
+	sinks := newFanoutSink()
+	if *debug {
+		sinks.Add("debug", &stdoutSink{}, 0)
+	}
+	if *listenAddr != "" {
+		exporter := newPrometheusExporter(config)
+		if err := exporter.Listen(*listenAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "Fehler beim Starten des Prometheus-Exporters: %v\n", err)
+			os.Exit(1)
+		}
+		sinks.Add("prometheus", exporter, 0)
+	}
+	if !*debug && *seqURL != "" {
+		seqOpts := seqOptions{
+			URL:           *seqURL,
+			BatchSize:     *seqBatchSize,
+			FlushInterval: *seqFlushInterval,
+			Gzip:          *seqGzip,
+
+			APIKey:         *seqAPIKey,
+			APIKeyFile:     *seqAPIKeyFile,
+			CACert:         *seqCACert,
+			ClientCert:     *seqClientCert,
+			ClientKey:      *seqClientKey,
+			RequestTimeout: *seqTimeout,
+		}
+		seq, err := newSeqSender(seqOpts, openSpoolOrNil(*spoolDir, *spoolMaxSize, *spoolMaxAge))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fehler beim Einrichten der Seq-Verbindung: %v\n", err)
+			os.Exit(1)
+		}
+		sinks.Add("seq", seq, 0)
+	}
+	if *filePath != "" {
+		file, err := newFileSink(fileSinkOptions{
+			Path:           *filePath,
+			MaxSizeMB:      *fileMaxSize,
+			RotateInterval: *fileRotateInterval,
+			MaxFiles:       *fileMaxFiles,
+			Compress:       *fileCompress,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fehler beim Öffnen der Ausgabedatei: %v\n", err)
+			os.Exit(1)
 		}
+		sinks.Add("file", file, 0)
 	}
+	if err := sinks.AddFromConfig(config); err != nil {
+		fmt.Fprintf(os.Stderr, "Fehler beim Einrichten der Ausgaben: %v\n", err)
+		os.Exit(1)
+	}
+	if sinks.Len() == 0 {
+		fmt.Fprintf(os.Stderr, "Warnung: Keine Ausgabe konfiguriert, Metriken werden nur gesammelt\n")
+	}
+	defer sinks.Close()
+
+	// Check if running as Windows service
+	if runtime.GOOS == "windows" && isWindowsService() {
+		runAsWindowsService(sinks, config, *interval)
+		return
+	}
+
+	// Stop cleanly on SIGINT/SIGTERM so collected events are flushed
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+
+	stopCh := make(chan struct{})
+	go func() {
+		<-signalCh
+		close(stopCh)
+	}()
+
+	runMonitoring(sinks, config, *interval, stopCh, make(chan struct{}))
+}
+
+// runMonitoring collects metrics every interval and hands them to the sink
+// until stopCh is closed. done is closed once the last sample was handed to
+// the sink, so the sink can be closed safely afterwards.
+func runMonitoring(sink Sink, config *Config, interval time.Duration, stopCh <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
 
 	// Get hostname
 	hostname := getHostname()
 
-	// Load configuration if available
-	config := loadConfig()
-
 	// Initial measurements
-	prevNetStats := getNetworkStats()
+	prevNetStats := getNetworkStats(config)
+	prevDiskIOStats := getDiskIOStats(config)
+	prevProcessStats := getProcessStats(config)
 	prevCPUStats := getCPUStats()
 	prevTime := time.Now()
 
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
-		time.Sleep(*interval)
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
 
 		// Current measurements
-		currNetStats := getNetworkStats()
+		currNetStats := getNetworkStats(config)
+		currDiskIOStats := getDiskIOStats(config)
+		currProcessStats := getProcessStats(config)
 		currCPUStats := getCPUStats()
 		currTime := time.Now()
 
@@ -122,22 +360,22 @@ func main() {
 		timeDiff := currTime.Sub(prevTime).Seconds()
 
 		// Get system metrics
-		metrics := collectMetrics(hostname, prevNetStats, currNetStats, prevCPUStats, currCPUStats, timeDiff, config)
+		metrics := collectMetrics(hostname, prevNetStats, currNetStats, prevCPUStats, currCPUStats, prevDiskIOStats, currDiskIOStats, prevProcessStats, currProcessStats, timeDiff, config)
 
-		if *debug {
-			printDebugMetrics(metrics)
-		} else {
-			sendToSeq(*seqURL, metrics)
+		if err := sink.Send(metrics); err != nil {
+			logError("Fehler bei der Ausgabe: %v", err)
 		}
 
 		// Update previous values
 		prevNetStats = currNetStats
+		prevDiskIOStats = currDiskIOStats
+		prevProcessStats = currProcessStats
 		prevCPUStats = currCPUStats
 		prevTime = currTime
 	}
 }
 
-func collectMetrics(hostname string, prevNet, currNet NetworkStats, prevCPU, currCPU CPUStats, timeDiff float64, config *Config) SystemMetrics {
+func collectMetrics(hostname string, prevNet, currNet NetworkStats, prevCPU, currCPU CPUStats, prevDiskIO, currDiskIO map[string]DiskIOCounters, prevProcs, currProcs ProcessStats, timeDiff float64, config *Config) SystemMetrics {
 	// CPU usage - calculate percentage over time interval
 	var cpuUsage float64
 
@@ -168,43 +406,96 @@ func collectMetrics(hostname string, prevNet, currNet NetworkStats, prevCPU, cur
 
 	// Disk usage (root filesystem or configured disk)
 	var diskPercent, diskFreeGB float64
-	var diskPath string
-
-	// Use configured disk if provided
-	if config != nil && config.Disk != "" {
-		diskPath = config.Disk
-	} else {
-		if runtime.GOOS == "windows" {
-			diskPath = "C:\\"
-		} else {
-			diskPath = "/"
-		}
-	}
-
-	diskInfo, err := disk.Usage(diskPath)
+	diskInfo, err := disk.Usage(primaryDiskPath(config))
 	if err == nil {
 		diskPercent = diskInfo.UsedPercent
 		diskFreeGB = float64(diskInfo.Free) / 1024 / 1024 / 1024
 	}
 
-	// Network I/O rates (bytes per second)
-	var netRXBPS, netTXBPS uint64
-	if timeDiff > 0 && currNet.RXBytes >= prevNet.RXBytes && currNet.TXBytes >= prevNet.TXBytes {
-		rxDiff := currNet.RXBytes - prevNet.RXBytes
-		txDiff := currNet.TXBytes - prevNet.TXBytes
-		netRXBPS = uint64(float64(rxDiff) / timeDiff)
-		netTXBPS = uint64(float64(txDiff) / timeDiff)
+	// Usage per configured or discovered filesystem
+	disks := getDiskUsages(config)
+
+	// Network I/O rates per interface and in total
+	netInterfaces := networkRates(prevNet, currNet, timeDiff)
+	var netTotal NetworkInterfaceUsage
+	for _, iface := range netInterfaces {
+		netTotal.RXBPS += iface.RXBPS
+		netTotal.TXBPS += iface.TXBPS
+		netTotal.RXPPS += iface.RXPPS
+		netTotal.TXPPS += iface.TXPPS
+		netTotal.RXErrors += iface.RXErrors
+		netTotal.TXErrors += iface.TXErrors
+		netTotal.RXDrops += iface.RXDrops
+		netTotal.TXDrops += iface.TXDrops
+	}
+	if config == nil || config.Network == nil || config.Network.Mode != "interface" {
+		netInterfaces = nil
 	}
 
-	// TCP connections (simplified - actual count may vary by OS)
-	tcpConns := getTCPConnectionCount()
+	// Disk I/O rates per device
+	diskIO := diskIORates(prevDiskIO, currDiskIO, timeDiff)
+
+	// TCP and UDP sockets
+	listeningPorts := config != nil && config.Sockets != nil && config.Sockets.ListeningPorts
+	sockets := getSocketStats(listeningPorts || portChecksNeedProcesses(config))
+
+	// Check configured ports
+	portCheckResult := checkPorts(config, sockets.Listening)
+	if !listeningPorts {
+		sockets.Listening = nil
+	}
 
 	// Check configured processes
-	processCheckResult := checkProcesses(config)
+	processCheckResult := checkProcesses(config, currProcs)
+
+	// Resource usage of the configured processes
+	processUsage := processUsages(config, prevProcs, currProcs, timeDiff)
+
+	// Load average and uptime
+	loadStats := getLoadStats()
+	var loadPerCPU1, loadPerCPU5, loadPerCPU15 float64
+	if loadStats.CPUCount > 0 {
+		loadPerCPU1 = loadStats.Load1 / float64(loadStats.CPUCount)
+		loadPerCPU5 = loadStats.Load5 / float64(loadStats.CPUCount)
+		loadPerCPU15 = loadStats.Load15 / float64(loadStats.CPUCount)
+	}
+	var bootTime string
+	if !loadStats.BootTime.IsZero() {
+		bootTime = loadStats.BootTime.Format(time.RFC3339)
+	}
+
+	// Per-mode and per-core CPU usage (Linux)
+	var cpuModes *CPUModes
+	if prevCPU.Modes != nil && currCPU.Modes != nil {
+		if modes, ok := cpuModePercents(*prevCPU.Modes, *currCPU.Modes); ok {
+			cpuModes = &modes
+		}
+	}
+
+	var cpuCores []CPUCoreUsage
+	prevCores := make(map[string]CPUTimes, len(prevCPU.Cores))
+	for _, core := range prevCPU.Cores {
+		prevCores[core.Name] = core
+	}
+	for _, core := range currCPU.Cores {
+		prev, found := prevCores[core.Name]
+		if !found {
+			// Core came online since the last sample
+			continue
+		}
+		if modes, ok := cpuModePercents(prev, core); ok {
+			cpuCores = append(cpuCores, CPUCoreUsage{
+				Core:     core.Name,
+				Percent:  100 - modes.Idle,
+				CPUModes: modes,
+			})
+		}
+	}
 
 	return SystemMetrics{
 		Timestamp:                time.Now().Format(time.RFC3339),
 		MessageTemplate:          "System Metrics from {Hostname}",
+		IntervalSeconds:          timeDiff,
 		Application:              "Monitor",
 		Hostname:                 hostname,
 		CPUPercent:               cpuUsage,
@@ -212,14 +503,75 @@ func collectMetrics(hostname string, prevNet, currNet NetworkStats, prevCPU, cur
 		MemoryMB:                 memMB,
 		DiskPercent:              diskPercent,
 		DiskFreeGB:               diskFreeGB,
-		NetworkRXBPS:             netRXBPS,
-		NetworkTXBPS:             netTXBPS,
-		TCPConnections:           tcpConns,
+		Disks:                    disks,
+		DiskIO:                   diskIO,
+		NetworkRXBPS:             netTotal.RXBPS,
+		NetworkTXBPS:             netTotal.TXBPS,
+		NetworkRXPPS:             netTotal.RXPPS,
+		NetworkTXPPS:             netTotal.TXPPS,
+		NetworkRXErrors:          netTotal.RXErrors,
+		NetworkTXErrors:          netTotal.TXErrors,
+		NetworkRXDrops:           netTotal.RXDrops,
+		NetworkTXDrops:           netTotal.TXDrops,
+		NetworkInterfaces:        netInterfaces,
+		TCPConnections:           sockets.TCP,
+		TCPIPv4:                  sockets.TCPIPv4,
+		TCPIPv6:                  sockets.TCPIPv6,
+		TCPStates:                sockets.TCPStates,
+		UDPSockets:               sockets.UDP,
+		UDPIPv4:                  sockets.UDPIPv4,
+		UDPIPv6:                  sockets.UDPIPv6,
+		ListeningPorts:           sockets.Listening,
 		ProcessesNotRunningCount: processCheckResult.NotRunningCount,
 		ProcessesNotRunning:      processCheckResult.NotRunning,
+		ProcessViolations:        processCheckResult.InstanceViolations,
+		Processes:                processUsage,
+		PortsMissingCount:        portCheckResult.MissingCount,
+		PortsMissing:             portCheckResult.Missing,
+		LoadAverage1:             loadStats.Load1,
+		LoadAverage5:             loadStats.Load5,
+		LoadAverage15:            loadStats.Load15,
+		LoadPerCPU1:              loadPerCPU1,
+		LoadPerCPU5:              loadPerCPU5,
+		LoadPerCPU15:             loadPerCPU15,
+		ProcsRunning:             loadStats.ProcsRunning,
+		ProcsBlocked:             loadStats.ProcsBlocked,
+		BootTime:                 bootTime,
+		UptimeSeconds:            uint64(loadStats.Uptime.Seconds()),
+		CPUModes:                 cpuModes,
+		CPUCores:                 cpuCores,
 	}
 }
 
+// cpuModePercents calculates the share of each mode between two samples.
+func cpuModePercents(prev, curr CPUTimes) (CPUModes, bool) {
+	if curr.Total() <= prev.Total() {
+		return CPUModes{}, false
+	}
+	total := float64(curr.Total() - prev.Total())
+
+	percent := func(prev, curr uint64) float64 {
+		// Counters may jump backwards, e.g. iowait on some kernels
+		if curr < prev {
+			return 0
+		}
+		return float64(curr-prev) * 100 / total
+	}
+
+	return CPUModes{
+		User:      percent(prev.User, curr.User),
+		Nice:      percent(prev.Nice, curr.Nice),
+		System:    percent(prev.System, curr.System),
+		Idle:      percent(prev.Idle, curr.Idle),
+		IOWait:    percent(prev.IOWait, curr.IOWait),
+		IRQ:       percent(prev.IRQ, curr.IRQ),
+		SoftIRQ:   percent(prev.SoftIRQ, curr.SoftIRQ),
+		Steal:     percent(prev.Steal, curr.Steal),
+		Guest:     percent(prev.Guest, curr.Guest),
+		GuestNice: percent(prev.GuestNice, curr.GuestNice),
+	}, true
+}
+
 func getCPUStats() CPUStats {
 	if runtime.GOOS == "linux" {
 		return getCPUStatsLinux()
@@ -232,35 +584,6 @@ func getCPUStats() CPUStats {
 	return CPUStats{}
 }
 
-func getNetworkStats() NetworkStats {
-	netStats, err := net.IOCounters(false)
-	if err != nil || len(netStats) == 0 {
-		return NetworkStats{}
-	}
-
-	var totalRX, totalTX uint64
-	for _, stat := range netStats {
-		// Skip loopback interfaces
-		if stat.Name != "lo" && stat.Name != "Loopback Pseudo-Interface 1" {
-			totalRX += stat.BytesRecv
-			totalTX += stat.BytesSent
-		}
-	}
-
-	return NetworkStats{
-		RXBytes: totalRX,
-		TXBytes: totalTX,
-	}
-}
-
-func getTCPConnectionCount() int {
-	connections, err := net.Connections("tcp")
-	if err != nil {
-		return 0
-	}
-	return len(connections)
-}
-
 func printDebugMetrics(metrics SystemMetrics) {
 	fmt.Println("===== System Metrics =====")
 	fmt.Printf("Timestamp: %s\n", metrics.Timestamp)
@@ -270,44 +593,156 @@ func printDebugMetrics(metrics SystemMetrics) {
 	fmt.Printf("Memory Usage: %.2f MB\n", metrics.MemoryMB)
 	fmt.Printf("Disk Usage: %.2f%%\n", metrics.DiskPercent)
 	fmt.Printf("Disk Free: %.2f GB\n", metrics.DiskFreeGB)
+	for _, d := range metrics.Disks {
+		fmt.Printf("Disk %s: %.2f%% used, %.2f GB free, %.2f%% inodes used\n", d.Path, d.Percent, float64(d.FreeBytes)/1024/1024/1024, d.InodesPercent)
+	}
+	for _, d := range metrics.DiskIO {
+		fmt.Printf("Disk I/O %s: %d/%d Bytes/s read/write, %.1f/%.1f IOPS, await %.2f ms, util %.2f%%\n", d.Device, d.ReadBPS, d.WriteBPS, d.ReadIOPS, d.WriteIOPS, d.AwaitMS, d.UtilPercent)
+	}
 	fmt.Printf("Network RX: %d Bytes/s\n", metrics.NetworkRXBPS)
 	fmt.Printf("Network TX: %d Bytes/s\n", metrics.NetworkTXBPS)
-	fmt.Printf("TCP Connections: %d\n", metrics.TCPConnections)
+	for _, iface := range metrics.NetworkInterfaces {
+		fmt.Printf("Network %s: RX %d Bytes/s, TX %d Bytes/s, %d/%d errors, %d/%d drops\n", iface.Interface, iface.RXBPS, iface.TXBPS, iface.RXErrors, iface.TXErrors, iface.RXDrops, iface.TXDrops)
+	}
+	fmt.Printf("TCP Connections: %d (IPv4 %d, IPv6 %d) %v\n", metrics.TCPConnections, metrics.TCPIPv4, metrics.TCPIPv6, metrics.TCPStates)
+	fmt.Printf("UDP Sockets: %d (IPv4 %d, IPv6 %d)\n", metrics.UDPSockets, metrics.UDPIPv4, metrics.UDPIPv6)
+	for _, port := range metrics.ListeningPorts {
+		fmt.Printf("Listening: %s %s:%d %s (PID %d)\n", port.Protocol, port.Address, port.Port, port.Process, port.PID)
+	}
 	fmt.Printf("Processes Not Running Count: %d\n", metrics.ProcessesNotRunningCount)
 	if len(metrics.ProcessesNotRunning) > 0 {
 		fmt.Printf("Processes Not Running: %v\n", metrics.ProcessesNotRunning)
 	}
+	if len(metrics.ProcessViolations) > 0 {
+		fmt.Printf("Process Instance Violations: %v\n", metrics.ProcessViolations)
+	}
+	for _, p := range metrics.Processes {
+		fmt.Printf("Process %s: %d instances, CPU %.2f%%, RSS %.2f MB, %d threads, %d FDs, read %d Bytes/s, write %d Bytes/s, up %ds\n",
+			p.Name, p.Instances, p.CPUPercent, float64(p.RSSBytes)/1024/1024, p.Threads, p.OpenFDs, p.ReadBPS, p.WriteBPS, p.UptimeSeconds)
+	}
+	fmt.Printf("Ports Missing Count: %d\n", metrics.PortsMissingCount)
+	if len(metrics.PortsMissing) > 0 {
+		fmt.Printf("Ports Missing: %v\n", metrics.PortsMissing)
+	}
 	fmt.Println("==========================")
 }
 
-func sendToSeq(seqURL string, metrics SystemMetrics) {
-	jsonData, err := json.Marshal(metrics)
+func getEnvWithDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDurationWithDefault(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := time.ParseDuration(value)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s - Fehler beim JSON-Encoding: %v\n",
-			time.Now().Format(time.RFC3339), err)
-		return
+		fmt.Fprintf(os.Stderr, "Fehler beim Parsen der %s-Umgebungsvariable: %v\n", key, err)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvIntWithDefault(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
 	}
 
-	resp, err := http.Post(seqURL+"/ingest/clef", "application/json", bytes.NewBuffer(jsonData))
+	parsed, err := strconv.Atoi(value)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s - Fehler beim Senden an Seq: %v\n",
-			time.Now().Format(time.RFC3339), err)
-		return
+		fmt.Fprintf(os.Stderr, "Fehler beim Parsen der %s-Umgebungsvariable: %v\n", key, err)
+		return defaultValue
 	}
-	defer resp.Body.Close()
+	return parsed
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		fmt.Fprintf(os.Stderr, "%s - Fehler beim Senden an Seq (HTTP %d): %s\n",
-			time.Now().Format(time.RFC3339), resp.StatusCode, string(body))
+func getEnvBoolWithDefault(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
 	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Fehler beim Parsen der %s-Umgebungsvariable: %v\n", key, err)
+		return defaultValue
+	}
+	return parsed
 }
 
-func getEnvWithDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// logError schreibt eine Fehlermeldung mit Zeitstempel auf stderr
+func logError(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "%s - %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+// executableDir liefert das Verzeichnis der laufenden Anwendung
+func executableDir() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
 	}
-	return defaultValue
+	return filepath.Dir(exe), nil
+}
+
+// openSpoolOrNil öffnet den Spool für nicht zustellbare Events. Ist der Spool
+// deaktiviert oder nicht verfügbar, wird nil zurückgegeben.
+func openSpoolOrNil(dir string, maxSizeMB int, maxAge time.Duration) *spool {
+	if maxSizeMB <= 0 {
+		return nil
+	}
+
+	if dir == "" {
+		exeDir, err := executableDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fehler beim Ermitteln des Spool-Verzeichnisses: %v\n", err)
+			return nil
+		}
+		dir = filepath.Join(exeDir, "spool")
+	}
+
+	sp, err := openSpool(dir, int64(maxSizeMB)*1024*1024, maxAge)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Fehler beim Öffnen des Spools %s: %v\n", dir, err)
+		return nil
+	}
+	return sp
+}
+
+// forwardedServiceArgs liefert alle explizit gesetzten Flags, die nicht
+// bereits von der Service-Installation selbst übergeben werden
+func forwardedServiceArgs() []string {
+	handled := map[string]bool{
+		"install": true, "uninstall": true, "service-name": true,
+		"seq-url": true, "interval": true, "debug": true, "d": true,
+		// Readable by every user listing processes, only the key file is
+		// forwarded
+		"seq-api-key": true,
+	}
+
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		if !handled[f.Name] {
+			args = append(args, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	return args
+}
+
+// isFlagSet reports whether the flag was given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 // getHostname ermittelt den Hostname, bevorzugt aus /etc/hostname für Docker-Container
@@ -329,12 +764,12 @@ func getHostname() string {
 }
 
 func loadConfig() *Config {
-	exe, err := os.Executable()
+	exeDir, err := executableDir()
 	if err != nil {
 		return nil
 	}
 
-	configPath := filepath.Join(filepath.Dir(exe), "config.json")
+	configPath := filepath.Join(exeDir, "config.json")
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		// Config file is optional
@@ -350,7 +785,17 @@ func loadConfig() *Config {
 	return &config
 }
 
-func checkProcesses(config *Config) ProcessCheckResult {
+// normalizeProcessName makes process names comparable: case-insensitive and
+// without .exe on Windows.
+func normalizeProcessName(name string) string {
+	name = strings.ToLower(name)
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, ".exe")
+	}
+	return name
+}
+
+func checkProcesses(config *Config, stats ProcessStats) ProcessCheckResult {
 	// If no processes configured, return 0 not running
 	if config == nil || len(config.Processes) == 0 {
 		return ProcessCheckResult{
@@ -359,43 +804,32 @@ func checkProcesses(config *Config) ProcessCheckResult {
 		}
 	}
 
-	// Get all running processes
-	processes, err := process.Processes()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Fehler beim Abrufen der Prozesse: %v\n", err)
+	// Process list could not be read
+	if !stats.Available {
+		names := processCheckNames(config.Processes)
 		return ProcessCheckResult{
-			NotRunningCount: len(config.Processes),
-			NotRunning:      config.Processes,
+			NotRunningCount: len(names),
+			NotRunning:      names,
 		}
 	}
 
-	// Create a map of running process names
-	runningProcesses := make(map[string]bool)
-	for _, p := range processes {
-		name, err := p.Name()
-		if err == nil && name != "" {
-			// Normalize process names: remove .exe on Windows
-			if runtime.GOOS == "windows" {
-				name = strings.TrimSuffix(strings.ToLower(name), ".exe")
-			}
-			runningProcesses[strings.ToLower(name)] = true
-		}
-	}
-
-	// Check configured processes
+	// Check configured processes; a process running too often is not
+	// reported as not running
 	notRunning := []string{}
-	for _, procName := range config.Processes {
-		normalizedName := strings.ToLower(procName)
-		if runtime.GOOS == "windows" {
-			normalizedName = strings.TrimSuffix(normalizedName, ".exe")
-		}
-		if !runningProcesses[normalizedName] {
-			notRunning = append(notRunning, procName)
+	var violations []string
+	for i, check := range config.Processes {
+		count := stats.Checks[i].Instances
+		switch {
+		case check.tooManyInstances(count):
+			violations = append(violations, fmt.Sprintf("%s (%d Instanzen, höchstens %d)", check.Name, count, check.MaxInstances))
+		case !check.instancesOK(count):
+			notRunning = append(notRunning, check.Name)
 		}
 	}
 
 	return ProcessCheckResult{
-		NotRunningCount: len(notRunning),
-		NotRunning:      notRunning,
+		NotRunningCount:    len(notRunning),
+		NotRunning:         notRunning,
+		InstanceViolations: violations,
 	}
 }
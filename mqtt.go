@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT control packet types
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttPubrec     = 5
+	mqttPubrel     = 6
+	mqttPubcomp    = 7
+	mqttPingreq    = 12
+	mqttPingresp   = 13
+	mqttDisconnect = 14
+)
+
+// mqttSinkConfig is the config.json representation of an MQTT sink.
+type mqttSinkConfig struct {
+	URL       string       `json:"url"`     // tcp://, mqtt://, tls:// or mqtts://
+	Version   string       `json:"version"` // "3.1.1" or "5"
+	ClientID  string       `json:"client_id"`
+	Username  string       `json:"username"`
+	Password  string       `json:"password"`
+	Topic     string       `json:"topic"`
+	QoS       int          `json:"qos"`
+	Retain    bool         `json:"retain"`
+	KeepAlive jsonDuration `json:"keep_alive"`
+	Timeout   jsonDuration `json:"timeout"`
+
+	// Retained "online" message after connecting and "offline" as last will
+	StatusTopic    string `json:"status_topic"`
+	OnlineMessage  string `json:"online_message"`
+	OfflineMessage string `json:"offline_message"`
+
+	CACert     string `json:"ca_cert"`
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+}
+
+// mqttSink publishes every sample as JSON to an MQTT broker. The connection
+// is established with the first sample, since topics and client ID contain
+// the hostname, and is re-established once after a failed publish.
+type mqttSink struct {
+	cfg     mqttSinkConfig
+	version byte
+	address string
+	tls     *tls.Config
+
+	mu       sync.Mutex
+	conn     *mqttConn
+	packetID uint16
+	hostname string
+}
+
+// mqttConn is a single broker connection. A reader goroutine hands
+// acknowledgements to the publisher and a pinger keeps the connection alive.
+type mqttConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+	acks    chan mqttPacket
+	dead    chan struct{}
+}
+
+type mqttPacket struct {
+	kind byte
+	body []byte
+}
+
+func init() {
+	registerSink("mqtt", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := mqttSinkConfig{
+			URL:            "tcp://localhost:1883",
+			Version:        "3.1.1",
+			Topic:          "hosts/{Hostname}/metrics",
+			KeepAlive:      jsonDuration(60 * time.Second),
+			Timeout:        jsonDuration(10 * time.Second),
+			StatusTopic:    "hosts/{Hostname}/status",
+			OnlineMessage:  "online",
+			OfflineMessage: "offline",
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+		return newMQTTSink(cfg)
+	})
+}
+
+func newMQTTSink(cfg mqttSinkConfig) (*mqttSink, error) {
+	s := &mqttSink{cfg: cfg}
+
+	switch cfg.Version {
+	case "3.1.1":
+		s.version = 4
+	case "5":
+		s.version = 5
+	default:
+		return nil, fmt.Errorf("nicht unterstützte MQTT-Version %q", cfg.Version)
+	}
+	if cfg.QoS < 0 || cfg.QoS > 2 {
+		return nil, fmt.Errorf("ungültiger QoS %d", cfg.QoS)
+	}
+	// MQTT 3.1.1 only allows a password together with a user name (3.1.2.9)
+	if s.version == 4 && cfg.Password != "" && cfg.Username == "" {
+		return nil, errors.New("password ohne username wird von MQTT 3.1.1 nicht unterstützt")
+	}
+	if time.Duration(cfg.KeepAlive) < time.Second {
+		return nil, errors.New("keep_alive muss mindestens 1s betragen")
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	s.address = u.Host
+
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if u.Port() == "" {
+			s.address = net.JoinHostPort(u.Hostname(), "1883")
+		}
+	case "tls", "mqtts", "ssl":
+		if u.Port() == "" {
+			s.address = net.JoinHostPort(u.Hostname(), "8883")
+		}
+		s.tls, err = newTLSConfig(cfg.CACert, cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		s.tls.ServerName = u.Hostname()
+	default:
+		return nil, fmt.Errorf("nicht unterstütztes Schema %q", u.Scheme)
+	}
+
+	return s, nil
+}
+
+func (s *mqttSink) Send(metrics SystemMetrics) error {
+	payload, err := json.Marshal(metrics)
+	if err != nil {
+		return fmt.Errorf("JSON-Encoding: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hostname = metrics.Hostname
+	topic := s.expandTopic(s.cfg.Topic)
+
+	// One retry with a fresh connection, e.g. after the broker restarted
+	for attempt := 0; ; attempt++ {
+		if err := s.connect(); err != nil {
+			return err
+		}
+
+		err := s.publish(topic, payload, byte(s.cfg.QoS), s.cfg.Retain)
+		if err == nil {
+			return nil
+		}
+
+		s.conn.Close()
+		s.conn = nil
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+func (s *mqttSink) Flush() error {
+	return nil
+}
+
+// Close publishes the offline status and disconnects. A clean disconnect
+// suppresses the last will, so the status is published explicitly.
+func (s *mqttSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	var errs []error
+	if s.cfg.StatusTopic != "" {
+		errs = append(errs, s.publish(s.expandTopic(s.cfg.StatusTopic), []byte(s.cfg.OfflineMessage), byte(s.cfg.QoS), true))
+	}
+	errs = append(errs, s.conn.write(mqttDisconnect<<4, nil, time.Duration(s.cfg.Timeout)))
+	errs = append(errs, s.conn.Close())
+	s.conn = nil
+
+	return errors.Join(errs...)
+}
+
+func (s *mqttSink) expandTopic(topic string) string {
+	return strings.NewReplacer("{Hostname}", s.hostname).Replace(topic)
+}
+
+// connect opens a new connection if there is none or the current one died.
+func (s *mqttSink) connect() error {
+	if s.conn != nil {
+		select {
+		case <-s.conn.dead:
+			s.conn.Close()
+			s.conn = nil
+		default:
+			return nil
+		}
+	}
+
+	timeout := time.Duration(s.cfg.Timeout)
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var netConn net.Conn
+	var err error
+	if s.tls != nil {
+		netConn, err = tls.DialWithDialer(dialer, "tcp", s.address, s.tls)
+	} else {
+		netConn, err = dialer.Dial("tcp", s.address)
+	}
+	if err != nil {
+		return err
+	}
+
+	c := &mqttConn{
+		Conn:   netConn,
+		reader: bufio.NewReader(netConn),
+		acks:   make(chan mqttPacket, 4),
+		dead:   make(chan struct{}),
+	}
+
+	if err := c.write(mqttConnect<<4, s.connectBody(), timeout); err != nil {
+		c.Close()
+		return err
+	}
+
+	c.SetReadDeadline(time.Now().Add(timeout))
+	packet, err := c.readPacket()
+	if err == nil {
+		err = s.checkConnack(packet)
+	}
+	if err != nil {
+		c.Close()
+		return fmt.Errorf("MQTT-Verbindung: %w", err)
+	}
+
+	keepAlive := time.Duration(s.cfg.KeepAlive)
+	go c.readLoop(keepAlive)
+	go c.pingLoop(keepAlive, timeout)
+	s.conn = c
+
+	if s.cfg.StatusTopic != "" {
+		err := s.publish(s.expandTopic(s.cfg.StatusTopic), []byte(s.cfg.OnlineMessage), byte(s.cfg.QoS), true)
+		if err != nil {
+			c.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *mqttSink) connectBody() []byte {
+	clientID := s.cfg.ClientID
+	if clientID == "" {
+		clientID = "host-monitor-" + s.hostname
+	}
+
+	flags := byte(0x02) // clean session
+	if s.cfg.StatusTopic != "" {
+		flags |= 0x04 | 0x20 | byte(s.cfg.QoS)<<3 // will, retained
+	}
+	if s.cfg.Username != "" {
+		flags |= 0x80
+	}
+	if s.cfg.Password != "" {
+		flags |= 0x40
+	}
+
+	b := mqttAppendString(nil, "MQTT")
+	b = append(b, s.version, flags)
+	b = binary.BigEndian.AppendUint16(b, uint16(time.Duration(s.cfg.KeepAlive)/time.Second))
+	if s.version == 5 {
+		b = append(b, 0) // no properties
+	}
+
+	b = mqttAppendString(b, clientID)
+	if s.cfg.StatusTopic != "" {
+		if s.version == 5 {
+			b = append(b, 0) // no will properties
+		}
+		b = mqttAppendString(b, s.expandTopic(s.cfg.StatusTopic))
+		b = mqttAppendString(b, s.cfg.OfflineMessage)
+	}
+	if s.cfg.Username != "" {
+		b = mqttAppendString(b, s.cfg.Username)
+	}
+	if s.cfg.Password != "" {
+		b = mqttAppendString(b, s.cfg.Password)
+	}
+	return b
+}
+
+func (s *mqttSink) checkConnack(packet mqttPacket) error {
+	if packet.kind != mqttConnack || len(packet.body) < 2 {
+		return fmt.Errorf("unerwartetes Paket %d statt CONNACK", packet.kind)
+	}
+
+	code := packet.body[1]
+	if s.version == 5 && code >= 0x80 || s.version == 4 && code != 0 {
+		return fmt.Errorf("vom Broker abgelehnt (Code %d)", code)
+	}
+	return nil
+}
+
+// publish sends a message and waits for the acknowledgements of its QoS.
+func (s *mqttSink) publish(topic string, payload []byte, qos byte, retain bool) error {
+	timeout := time.Duration(s.cfg.Timeout)
+
+	s.packetID++
+	if s.packetID == 0 {
+		s.packetID = 1
+	}
+	id := s.packetID
+
+	header := byte(mqttPublish<<4) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+
+	b := mqttAppendString(nil, topic)
+	if qos > 0 {
+		b = binary.BigEndian.AppendUint16(b, id)
+	}
+	if s.version == 5 {
+		b = append(b, 0) // no properties
+	}
+	b = append(b, payload...)
+
+	if err := s.conn.write(header, b, timeout); err != nil {
+		return err
+	}
+
+	switch qos {
+	case 1:
+		return s.awaitAck(mqttPuback, id, timeout)
+	case 2:
+		if err := s.awaitAck(mqttPubrec, id, timeout); err != nil {
+			return err
+		}
+		if err := s.conn.write(mqttPubrel<<4|0x02, binary.BigEndian.AppendUint16(nil, id), timeout); err != nil {
+			return err
+		}
+		return s.awaitAck(mqttPubcomp, id, timeout)
+	}
+	return nil
+}
+
+func (s *mqttSink) awaitAck(kind byte, id uint16, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case packet := <-s.conn.acks:
+			if packet.kind != kind || len(packet.body) < 2 || binary.BigEndian.Uint16(packet.body) != id {
+				continue // late acknowledgement of an earlier attempt
+			}
+			// MQTT 5 appends a reason code, 3.1.1 acknowledgements always succeed
+			if len(packet.body) > 2 && packet.body[2] >= 0x80 {
+				return fmt.Errorf("vom Broker abgelehnt (Code %d)", packet.body[2])
+			}
+			return nil
+		case <-s.conn.dead:
+			return errors.New("Verbindung zum MQTT-Broker getrennt")
+		case <-deadline:
+			return errors.New("Zeitüberschreitung beim Warten auf Bestätigung")
+		}
+	}
+}
+
+func (c *mqttConn) write(header byte, body []byte, timeout time.Duration) error {
+	packet := append([]byte{header}, mqttAppendVarInt(nil, len(body))...)
+	packet = append(packet, body...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.SetWriteDeadline(time.Now().Add(timeout))
+	_, err := c.Write(packet)
+	return err
+}
+
+func (c *mqttConn) readPacket() (mqttPacket, error) {
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return mqttPacket{}, err
+	}
+
+	var length, shift int
+	for {
+		digit, err := c.reader.ReadByte()
+		if err != nil {
+			return mqttPacket{}, err
+		}
+		length |= int(digit&0x7f) << shift
+		if digit&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return mqttPacket{}, errors.New("ungültige Paketlänge")
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return mqttPacket{}, err
+	}
+	return mqttPacket{kind: header >> 4, body: body}, nil
+}
+
+// readLoop dispatches incoming packets until the connection fails. Without
+// any packet, not even a ping response, for 1.5 times the keep alive the
+// connection is considered dead.
+func (c *mqttConn) readLoop(keepAlive time.Duration) {
+	defer close(c.dead)
+
+	for {
+		c.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		packet, err := c.readPacket()
+		if err != nil {
+			c.Close()
+			return
+		}
+
+		switch packet.kind {
+		case mqttPuback, mqttPubrec, mqttPubcomp:
+			select {
+			case c.acks <- packet:
+			default:
+			}
+		case mqttDisconnect:
+			c.Close()
+			return
+		}
+	}
+}
+
+func (c *mqttConn) pingLoop(keepAlive, timeout time.Duration) {
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.write(mqttPingreq<<4, nil, timeout); err != nil {
+				c.Close()
+				return
+			}
+		case <-c.dead:
+			return
+		}
+	}
+}
+
+func mqttAppendString(b []byte, value string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(value)))
+	return append(b, value...)
+}
+
+// mqttAppendVarInt appends a variable byte integer as used for the
+// remaining length.
+func mqttAppendVarInt(b []byte, value int) []byte {
+	for {
+		digit := byte(value % 128)
+		value /= 128
+		if value > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if value == 0 {
+			return b
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+// mqttTestPacket is a packet received by the broker stand-in including the
+// flags of the fixed header.
+type mqttTestPacket struct {
+	header byte
+	body   []byte
+}
+
+// mqttTestPublish is a decoded PUBLISH packet.
+type mqttTestPublish struct {
+	qos     byte
+	retain  bool
+	topic   string
+	id      uint16
+	payload []byte
+}
+
+// startMQTTTestBroker accepts a single connection, acknowledges CONNECT and
+// PUBLISH as a broker would and reports every received packet.
+func startMQTTTestBroker(t *testing.T, version byte) (string, chan mqttTestPacket) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	packets := make(chan mqttTestPacket, 16)
+	go func() {
+		defer close(packets)
+
+		netConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer netConn.Close()
+		c := &mqttConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+
+		for {
+			header, err := c.reader.Peek(1)
+			if err != nil {
+				return
+			}
+			flags := header[0]
+			packet, err := c.readPacket()
+			if err != nil {
+				return
+			}
+			packets <- mqttTestPacket{header: flags, body: packet.body}
+
+			var id []byte
+			if len(packet.body) >= 2 {
+				id = packet.body[:2]
+			}
+			switch packet.kind {
+			case mqttConnect:
+				ack := []byte{0, 0}
+				if version == 5 {
+					ack = append(ack, 0) // no properties
+				}
+				c.write(mqttConnack<<4, ack, time.Second)
+			case mqttPublish:
+				p := decodeMQTTTestPublish(t, flags, packet.body, version)
+				switch p.qos {
+				case 1:
+					c.write(mqttPuback<<4, binary.BigEndian.AppendUint16(nil, p.id), time.Second)
+				case 2:
+					c.write(mqttPubrec<<4, binary.BigEndian.AppendUint16(nil, p.id), time.Second)
+				}
+			case mqttPubrel:
+				c.write(mqttPubcomp<<4, id, time.Second)
+			case mqttPingreq:
+				c.write(mqttPingresp<<4, nil, time.Second)
+			case mqttDisconnect:
+				return
+			}
+		}
+	}()
+
+	return listener.Addr().String(), packets
+}
+
+func decodeMQTTTestPublish(t *testing.T, header byte, body []byte, version byte) mqttTestPublish {
+	p := mqttTestPublish{qos: header >> 1 & 0x03, retain: header&0x01 != 0}
+
+	n := int(binary.BigEndian.Uint16(body))
+	p.topic = string(body[2 : 2+n])
+	body = body[2+n:]
+	if p.qos > 0 {
+		p.id = binary.BigEndian.Uint16(body)
+		body = body[2:]
+	}
+	if version == 5 {
+		if body[0] != 0 {
+			t.Errorf("PUBLISH properties length %d, want 0", body[0])
+		}
+		body = body[1:]
+	}
+	p.payload = body
+	return p
+}
+
+func nextMQTTTestPacket(t *testing.T, packets chan mqttTestPacket, kind byte) mqttTestPacket {
+	t.Helper()
+	select {
+	case packet, ok := <-packets:
+		if !ok {
+			t.Fatalf("connection closed, want packet %d", kind)
+		}
+		if packet.header>>4 != kind {
+			t.Fatalf("got packet %d, want %d", packet.header>>4, kind)
+		}
+		return packet
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no packet %d received", kind)
+	}
+	return mqttTestPacket{}
+}
+
+func newTestMQTTSink(t *testing.T, address string, cfg mqttSinkConfig) *mqttSink {
+	t.Helper()
+	cfg.URL = "tcp://" + address
+	if cfg.Version == "" {
+		cfg.Version = "3.1.1"
+	}
+	cfg.Topic = "hosts/{Hostname}/metrics"
+	cfg.KeepAlive = jsonDuration(60 * time.Second)
+	cfg.Timeout = jsonDuration(2 * time.Second)
+
+	sink, err := newMQTTSink(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sink
+}
+
+func TestMQTTConfigPasswordWithoutUsername(t *testing.T) {
+	tests := []struct {
+		version string
+		valid   bool
+	}{
+		{"3.1.1", false},
+		{"5", true},
+	}
+	for _, tt := range tests {
+		raw, _ := json.Marshal(map[string]string{"version": tt.version, "password": "secret"})
+		_, err := sinkFactories["mqtt"]("mqtt-1", raw, nil)
+		if (err == nil) != tt.valid {
+			t.Errorf("version %s: err = %v, want valid = %t", tt.version, err, tt.valid)
+		}
+	}
+}
+
+func TestMQTTSinkConnectWithLastWill(t *testing.T) {
+	address, packets := startMQTTTestBroker(t, 4)
+	sink := newTestMQTTSink(t, address, mqttSinkConfig{
+		Username:       "edge01",
+		Password:       "secret",
+		QoS:            1,
+		StatusTopic:    "hosts/{Hostname}/status",
+		OnlineMessage:  "online",
+		OfflineMessage: "offline",
+	})
+	defer sink.Close()
+
+	if err := sink.Send(SystemMetrics{Hostname: "web01"}); err != nil {
+		t.Fatal(err)
+	}
+
+	connect := nextMQTTTestPacket(t, packets, mqttConnect)
+	var want []byte
+	want = mqttAppendString(want, "MQTT")
+	want = append(want, 4)    // protocol level 3.1.1
+	want = append(want, 0xEE) // user name, password, will retain, will QoS 1, will, clean session
+	want = append(want, 0, 60)
+	want = mqttAppendString(want, "host-monitor-web01")
+	want = mqttAppendString(want, "hosts/web01/status")
+	want = mqttAppendString(want, "offline")
+	want = mqttAppendString(want, "edge01")
+	want = mqttAppendString(want, "secret")
+	if !bytes.Equal(connect.body, want) {
+		t.Errorf("CONNECT =\n% x\nwant\n% x", connect.body, want)
+	}
+
+	online := nextMQTTTestPacket(t, packets, mqttPublish)
+	p := decodeMQTTTestPublish(t, online.header, online.body, 4)
+	if p.topic != "hosts/web01/status" || string(p.payload) != "online" || !p.retain || p.qos != 1 {
+		t.Errorf("status message = %+v", p)
+	}
+
+	metrics := nextMQTTTestPacket(t, packets, mqttPublish)
+	p = decodeMQTTTestPublish(t, metrics.header, metrics.body, 4)
+	if p.topic != "hosts/web01/metrics" || p.retain || p.qos != 1 {
+		t.Errorf("metrics message = %+v", p)
+	}
+	var decoded SystemMetrics
+	if err := json.Unmarshal(p.payload, &decoded); err != nil || decoded.Hostname != "web01" {
+		t.Errorf("payload %s: %v", p.payload, err)
+	}
+
+	// A clean shutdown suppresses the will, so the status is sent explicitly
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	offline := nextMQTTTestPacket(t, packets, mqttPublish)
+	p = decodeMQTTTestPublish(t, offline.header, offline.body, 4)
+	if p.topic != "hosts/web01/status" || string(p.payload) != "offline" || !p.retain {
+		t.Errorf("offline message = %+v", p)
+	}
+	nextMQTTTestPacket(t, packets, mqttDisconnect)
+}
+
+func TestMQTTSinkPublishQoS2(t *testing.T) {
+	address, packets := startMQTTTestBroker(t, 5)
+	sink := newTestMQTTSink(t, address, mqttSinkConfig{Version: "5", QoS: 2})
+	defer sink.Close()
+
+	if err := sink.Send(SystemMetrics{Hostname: "web01"}); err != nil {
+		t.Fatal(err)
+	}
+
+	connect := nextMQTTTestPacket(t, packets, mqttConnect)
+	var want []byte
+	want = mqttAppendString(want, "MQTT")
+	want = append(want, 5, 0x02, 0, 60, 0) // MQTT 5, clean start, no properties
+	want = mqttAppendString(want, "host-monitor-web01")
+	if !bytes.Equal(connect.body, want) {
+		t.Errorf("CONNECT =\n% x\nwant\n% x", connect.body, want)
+	}
+
+	publish := nextMQTTTestPacket(t, packets, mqttPublish)
+	p := decodeMQTTTestPublish(t, publish.header, publish.body, 5)
+	if p.qos != 2 || p.id == 0 {
+		t.Errorf("PUBLISH = %+v", p)
+	}
+
+	pubrel := nextMQTTTestPacket(t, packets, mqttPubrel)
+	if pubrel.header&0x0f != 0x02 {
+		t.Errorf("PUBREL flags %#x, want 0x02", pubrel.header&0x0f)
+	}
+	if binary.BigEndian.Uint16(pubrel.body) != p.id {
+		t.Errorf("PUBREL for packet %d, want %d", binary.BigEndian.Uint16(pubrel.body), p.id)
+	}
+}
+
+func TestMQTTSinkAckTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// Accepts the connection but never acknowledges the PUBLISH
+	go func() {
+		for {
+			netConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			c := &mqttConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+			c.readPacket()
+			c.write(mqttConnack<<4, []byte{0, 0}, time.Second)
+		}
+	}()
+
+	sink := newTestMQTTSink(t, listener.Addr().String(), mqttSinkConfig{QoS: 1})
+	sink.cfg.Timeout = jsonDuration(100 * time.Millisecond)
+	defer sink.Close()
+
+	if err := sink.Send(SystemMetrics{Hostname: "web01"}); err == nil {
+		t.Error("Send succeeded without PUBACK")
+	}
+}
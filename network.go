@@ -0,0 +1,132 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// networkConfig filters the interfaces included in the network metrics.
+// Patterns use path.Match syntax, e.g. "veth*" or "br-*".
+type networkConfig struct {
+	IncludeInterfaces []string `json:"include_interfaces"`
+	ExcludeInterfaces []string `json:"exclude_interfaces"`
+	Mode              string   `json:"mode"` // "total" or "interface"
+}
+
+// NetworkCounters are the cumulative counters of one network interface.
+type NetworkCounters struct {
+	RXBytes, TXBytes     uint64
+	RXPackets, TXPackets uint64
+	RXErrors, TXErrors   uint64
+	RXDrops, TXDrops     uint64
+}
+
+// NetworkStats holds the counters per interface.
+type NetworkStats map[string]NetworkCounters
+
+// NetworkInterfaceUsage is the traffic of one interface between two samples.
+// Errors and drops are counted since the previous sample.
+type NetworkInterfaceUsage struct {
+	Interface string  `json:"Interface"`
+	RXBPS     uint64  `json:"RX_BPS"`
+	TXBPS     uint64  `json:"TX_BPS"`
+	RXPPS     float64 `json:"RX_PPS"`
+	TXPPS     float64 `json:"TX_PPS"`
+	RXErrors  uint64  `json:"RX_Errors"`
+	TXErrors  uint64  `json:"TX_Errors"`
+	RXDrops   uint64  `json:"RX_Drops"`
+	TXDrops   uint64  `json:"TX_Drops"`
+}
+
+// getNetworkStats returns the counters of all interfaces passing the
+// configured filters. Loopback interfaces are skipped unless explicitly
+// included.
+func getNetworkStats(config *Config) NetworkStats {
+	var cfg networkConfig
+	if config != nil && config.Network != nil {
+		cfg = *config.Network
+	}
+
+	netStats, err := net.IOCounters(true)
+	if err != nil || len(netStats) == 0 {
+		return NetworkStats{}
+	}
+
+	loopback := make(map[string]bool)
+	if interfaces, err := net.Interfaces(); err == nil {
+		for _, iface := range interfaces {
+			for _, flag := range iface.Flags {
+				if flag == "loopback" {
+					loopback[iface.Name] = true
+				}
+			}
+		}
+	}
+
+	stats := make(NetworkStats, len(netStats))
+	for _, stat := range netStats {
+		if len(cfg.IncludeInterfaces) > 0 {
+			if !matchAnyPattern(cfg.IncludeInterfaces, stat.Name) {
+				continue
+			}
+		} else if loopback[stat.Name] {
+			continue
+		}
+		if matchAnyPattern(cfg.ExcludeInterfaces, stat.Name) {
+			continue
+		}
+
+		stats[stat.Name] = NetworkCounters{
+			RXBytes:   stat.BytesRecv,
+			TXBytes:   stat.BytesSent,
+			RXPackets: stat.PacketsRecv,
+			TXPackets: stat.PacketsSent,
+			RXErrors:  stat.Errin,
+			TXErrors:  stat.Errout,
+			RXDrops:   stat.Dropin,
+			TXDrops:   stat.Dropout,
+		}
+	}
+
+	return stats
+}
+
+// networkRates calculates the traffic per interface. Interfaces without a
+// previous sample or with counters that went backwards, e.g. after a
+// container restart recreated a veth pair, are skipped.
+func networkRates(prev, curr NetworkStats, timeDiff float64) []NetworkInterfaceUsage {
+	if timeDiff <= 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(curr))
+	for name := range curr {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var usages []NetworkInterfaceUsage
+	for _, name := range names {
+		c := curr[name]
+		p, found := prev[name]
+		if !found || c.RXBytes < p.RXBytes || c.TXBytes < p.TXBytes || c.RXPackets < p.RXPackets ||
+			c.TXPackets < p.TXPackets || c.RXErrors < p.RXErrors || c.TXErrors < p.TXErrors ||
+			c.RXDrops < p.RXDrops || c.TXDrops < p.TXDrops {
+			continue
+		}
+
+		usages = append(usages, NetworkInterfaceUsage{
+			Interface: name,
+			RXBPS:     uint64(float64(c.RXBytes-p.RXBytes) / timeDiff),
+			TXBPS:     uint64(float64(c.TXBytes-p.TXBytes) / timeDiff),
+			RXPPS:     float64(c.RXPackets-p.RXPackets) / timeDiff,
+			TXPPS:     float64(c.TXPackets-p.TXPackets) / timeDiff,
+			RXErrors:  c.RXErrors - p.RXErrors,
+			TXErrors:  c.TXErrors - p.TXErrors,
+			RXDrops:   c.RXDrops - p.RXDrops,
+			TXDrops:   c.TXDrops - p.TXDrops,
+		})
+	}
+	return usages
+}
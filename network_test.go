@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetworkRates(t *testing.T) {
+	prev := NetworkStats{
+		"eth0":  {RXBytes: 1000, TXBytes: 2000, RXPackets: 10, TXPackets: 20, RXErrors: 1, TXDrops: 2},
+		"veth1": {RXBytes: 5000, TXBytes: 5000},
+		"gone":  {RXBytes: 1},
+	}
+	curr := NetworkStats{
+		"eth0": {RXBytes: 3000, TXBytes: 6000, RXPackets: 30, TXPackets: 60, RXErrors: 4, TXDrops: 2},
+		// Recreated by a container restart, the counters start at 0 again
+		"veth1": {RXBytes: 100, TXBytes: 100},
+		// Came up since the previous sample
+		"veth2": {RXBytes: 100, TXBytes: 100},
+	}
+
+	got := networkRates(prev, curr, 2)
+	want := []NetworkInterfaceUsage{{
+		Interface: "eth0",
+		RXBPS:     1000,
+		TXBPS:     2000,
+		RXPPS:     10,
+		TXPPS:     20,
+		RXErrors:  3,
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got := networkRates(prev, curr, 0); got != nil {
+		t.Errorf("without elapsed time got %+v, want nil", got)
+	}
+}
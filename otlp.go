@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	otlpTemporalityDelta      = 1
+	otlpTemporalityCumulative = 2
+)
+
+// otlpSinkConfig is the config.json representation of an OTLP/HTTP sink.
+type otlpSinkConfig struct {
+	URL      string            `json:"url"`
+	Encoding string            `json:"encoding"` // "protobuf" or "json"
+	Headers  map[string]string `json:"headers"`
+	Timeout  jsonDuration      `json:"timeout"`
+}
+
+// otlpSink exports samples as OpenTelemetry metrics via OTLP/HTTP, using the
+// semantic-convention metric names where one exists.
+type otlpSink struct {
+	cfg      otlpSinkConfig
+	endpoint string
+	client   *http.Client
+}
+
+func init() {
+	registerSink("otlp", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := otlpSinkConfig{
+			URL:      "http://localhost:4318",
+			Encoding: "protobuf",
+			Timeout:  jsonDuration(10 * time.Second),
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Encoding != "protobuf" && cfg.Encoding != "json" {
+			return nil, fmt.Errorf("unbekanntes Encoding %q", cfg.Encoding)
+		}
+
+		return &otlpSink{
+			cfg:      cfg,
+			endpoint: strings.TrimSuffix(cfg.URL, "/") + "/v1/metrics",
+			client:   &http.Client{Timeout: time.Duration(cfg.Timeout)},
+		}, nil
+	})
+}
+
+func (s *otlpSink) Send(metrics SystemMetrics) error {
+	request := s.buildRequest(metrics)
+
+	var body []byte
+	var contentType string
+	if s.cfg.Encoding == "json" {
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		contentType = "application/json"
+	} else {
+		body = request.marshalProto()
+		contentType = "application/x-protobuf"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range s.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkHTTPResponse(resp)
+}
+
+func (s *otlpSink) Flush() error {
+	return nil
+}
+
+func (s *otlpSink) Close() error {
+	return nil
+}
+
+func (s *otlpSink) buildRequest(m SystemMetrics) otlpExportRequest {
+	now := metricsTime(m)
+
+	point := func(value float64, attrs ...otlpKeyValue) otlpDataPoint {
+		return otlpDataPoint{TimeUnixNano: otlpNanos(now), AsDouble: value, Attributes: attrs}
+	}
+	gauge := func(name, unit string, points ...otlpDataPoint) otlpMetric {
+		return otlpMetric{Name: name, Unit: unit, Gauge: &otlpGauge{DataPoints: points}}
+	}
+	upDownCounter := func(name, unit string, points ...otlpDataPoint) otlpMetric {
+		return otlpMetric{Name: name, Unit: unit, Sum: &otlpSum{
+			DataPoints:             points,
+			AggregationTemporality: otlpTemporalityCumulative,
+		}}
+	}
+
+	// Amounts since the previous sample are reported as delta counter;
+	// rates are multiplied with the sample interval first. The interval
+	// travels with the event, so spooled events keep their own.
+	elapsed := m.IntervalSeconds
+	start := now.Add(-time.Duration(elapsed * float64(time.Second)))
+	deltaPoint := func(amount float64, attrs ...otlpKeyValue) otlpDataPoint {
+		p := point(amount, attrs...)
+		p.StartTimeUnixNano = otlpNanos(start)
+		return p
+	}
+	deltaCounter := func(name, unit string, points ...otlpDataPoint) otlpMetric {
+		return otlpMetric{Name: name, Unit: unit, Sum: &otlpSum{
+			DataPoints:             points,
+			AggregationTemporality: otlpTemporalityDelta,
+			IsMonotonic:            true,
+		}}
+	}
+
+	// The modes are reported per core if known and for all cores otherwise,
+	// so summing up system.cpu.utilization never mixes the levels. The busy
+	// share goes into a metric of its own, since it is the sum of the modes.
+	// Without modes CPU_Percent is the only point.
+	var cpuPoints, cpuUsage []otlpDataPoint
+	switch {
+	case len(m.CPUCores) > 0:
+		for _, core := range m.CPUCores {
+			cpuPoints = append(cpuPoints, otlpCPUModePoints(point, core.Core, core.CPUModes)...)
+			cpuUsage = append(cpuUsage, point(core.Percent/100, otlpAttr("cpu", core.Core)))
+		}
+	case m.CPUModes != nil:
+		cpuPoints = otlpCPUModePoints(point, "", *m.CPUModes)
+		cpuUsage = []otlpDataPoint{point(m.CPUPercent / 100)}
+	default:
+		cpuPoints = []otlpDataPoint{point(m.CPUPercent / 100)}
+		cpuUsage = cpuPoints
+	}
+
+	// Without mountpoint the points describe the disk from Disk_Percent,
+	// which is only reported when there are no values per filesystem
+	var fsUtilization, fsUsage, fsInodes []otlpDataPoint
+	if len(m.Disks) == 0 {
+		fsUtilization = append(fsUtilization, point(m.DiskPercent/100))
+		fsUsage = append(fsUsage, point(m.DiskFreeGB*1024*1024*1024, otlpAttr("system.filesystem.state", "free")))
+	}
+	for _, d := range m.Disks {
+		attrs := []otlpKeyValue{otlpAttr("system.filesystem.mountpoint", d.Path)}
+		if d.Device != "" {
+			attrs = append(attrs, otlpAttr("system.device", d.Device))
+		}
+		if d.FSType != "" {
+			attrs = append(attrs, otlpAttr("system.filesystem.type", d.FSType))
+		}
+		withState := func(state string) []otlpKeyValue {
+			return append(slices.Clip(attrs), otlpAttr("system.filesystem.state", state))
+		}
+
+		fsUtilization = append(fsUtilization, point(d.Percent/100, attrs...))
+		fsUsage = append(fsUsage,
+			point(float64(d.UsedBytes), withState("used")...),
+			point(float64(d.FreeBytes), withState("free")...))
+		if d.InodesTotal > 0 {
+			fsInodes = append(fsInodes,
+				point(float64(d.InodesTotal-min(d.InodesFree, d.InodesTotal)), withState("used")...),
+				point(float64(d.InodesFree), withState("free")...))
+		}
+	}
+
+	// The sum of all monitored interfaces is only reported without
+	// network.interface.name when there are no values per interface, so
+	// summing up the metric does not count traffic twice
+	var networkIO, networkPackets, networkErrors, networkDropped []otlpDataPoint
+	addNetwork := func(n NetworkInterfaceUsage, attrs ...otlpKeyValue) {
+		rx := append(slices.Clip(attrs), otlpAttr("network.io.direction", "receive"))
+		tx := append(slices.Clip(attrs), otlpAttr("network.io.direction", "transmit"))
+		networkIO = append(networkIO, deltaPoint(float64(n.RXBPS)*elapsed, rx...), deltaPoint(float64(n.TXBPS)*elapsed, tx...))
+		networkPackets = append(networkPackets, deltaPoint(n.RXPPS*elapsed, rx...), deltaPoint(n.TXPPS*elapsed, tx...))
+		networkErrors = append(networkErrors, deltaPoint(float64(n.RXErrors), rx...), deltaPoint(float64(n.TXErrors), tx...))
+		networkDropped = append(networkDropped, deltaPoint(float64(n.RXDrops), rx...), deltaPoint(float64(n.TXDrops), tx...))
+	}
+	if len(m.NetworkInterfaces) == 0 {
+		addNetwork(NetworkInterfaceUsage{
+			RXBPS:    m.NetworkRXBPS,
+			TXBPS:    m.NetworkTXBPS,
+			RXPPS:    m.NetworkRXPPS,
+			TXPPS:    m.NetworkTXPPS,
+			RXErrors: m.NetworkRXErrors,
+			TXErrors: m.NetworkTXErrors,
+			RXDrops:  m.NetworkRXDrops,
+			TXDrops:  m.NetworkTXDrops,
+		})
+	}
+	for _, iface := range m.NetworkInterfaces {
+		addNetwork(iface, otlpAttr("network.interface.name", iface.Interface))
+	}
+
+	// Known TCP states split the connections by network.connection.state
+	tcp := otlpAttr("network.transport", "tcp")
+	udp := otlpAttr("network.transport", "udp")
+	connections := []otlpDataPoint{point(float64(m.TCPConnections), tcp)}
+	if len(m.TCPStates) > 0 {
+		connections = connections[:0]
+		for _, state := range sortedStateNames(m.TCPStates) {
+			connections = append(connections, point(float64(m.TCPStates[state]), tcp, otlpAttr("network.connection.state", otlpConnectionState(state))))
+		}
+	}
+	connections = append(connections, point(float64(m.UDPSockets), udp))
+
+	metrics := []otlpMetric{
+		gauge("system.cpu.utilization", "1", cpuPoints...),
+		gauge("host_monitor.cpu.usage", "1", cpuUsage...),
+		gauge("system.cpu.load_average.1m", "{thread}",
+			point(m.LoadAverage1)),
+		gauge("system.cpu.load_average.5m", "{thread}",
+			point(m.LoadAverage5)),
+		gauge("system.cpu.load_average.15m", "{thread}",
+			point(m.LoadAverage15)),
+		gauge("host_monitor.load_per_cpu.1m", "{thread}",
+			point(m.LoadPerCPU1)),
+		gauge("host_monitor.load_per_cpu.5m", "{thread}",
+			point(m.LoadPerCPU5)),
+		gauge("host_monitor.load_per_cpu.15m", "{thread}",
+			point(m.LoadPerCPU15)),
+		upDownCounter("system.processes.count", "{process}",
+			point(float64(m.ProcsRunning), otlpAttr("status", "running")),
+			point(float64(m.ProcsBlocked), otlpAttr("status", "blocked"))),
+		gauge("system.uptime", "s",
+			point(float64(m.UptimeSeconds))),
+		gauge("system.memory.utilization", "1",
+			point(m.MemoryPercent/100, otlpAttr("system.memory.state", "used"))),
+		upDownCounter("system.memory.usage", "By",
+			point(m.MemoryMB*1024*1024, otlpAttr("system.memory.state", "used"))),
+		gauge("system.filesystem.utilization", "1", fsUtilization...),
+		upDownCounter("system.filesystem.usage", "By", fsUsage...),
+		deltaCounter("system.network.io", "By", networkIO...),
+		deltaCounter("system.network.packets", "{packet}", networkPackets...),
+		deltaCounter("system.network.errors", "{error}", networkErrors...),
+		deltaCounter("system.network.dropped", "{packet}", networkDropped...),
+		upDownCounter("system.network.connections", "{connection}", connections...),
+		upDownCounter("host_monitor.network.sockets", "{socket}",
+			point(float64(m.TCPIPv4), tcp, otlpAttr("network.type", "ipv4")),
+			point(float64(m.TCPIPv6), tcp, otlpAttr("network.type", "ipv6")),
+			point(float64(m.UDPIPv4), udp, otlpAttr("network.type", "ipv4")),
+			point(float64(m.UDPIPv6), udp, otlpAttr("network.type", "ipv6"))),
+		gauge("host_monitor.processes.not_running", "{process}",
+			point(float64(m.ProcessesNotRunningCount))),
+		gauge("host_monitor.ports.missing", "{port}",
+			point(float64(m.PortsMissingCount))),
+	}
+
+	if len(m.ListeningPorts) > 0 {
+		var ports []otlpDataPoint
+		for _, port := range m.ListeningPorts {
+			attrs := []otlpKeyValue{
+				otlpAttr("network.transport", port.Protocol),
+				otlpAttr("network.local.address", port.Address),
+				otlpAttr("network.local.port", strconv.FormatUint(uint64(port.Port), 10)),
+			}
+			if port.Process != "" {
+				attrs = append(attrs, otlpAttr("process.executable.name", port.Process))
+			}
+			ports = append(ports, point(1, attrs...))
+		}
+		metrics = append(metrics, gauge("host_monitor.listening_port", "1", ports...))
+	}
+
+	// The values are summed up over all instances of a configured process,
+	// so they use host_monitor names instead of the per-process conventions
+	if len(m.Processes) > 0 {
+		var instances, cpu, memory, threads, fds, diskIO, uptime []otlpDataPoint
+		for _, p := range m.Processes {
+			name := otlpAttr("process.executable.name", p.Name)
+			instances = append(instances, point(float64(p.Instances), name))
+			cpu = append(cpu, point(p.CPUPercent/100, name))
+			memory = append(memory, point(float64(p.RSSBytes), name))
+			threads = append(threads, point(float64(p.Threads), name))
+			fds = append(fds, point(float64(p.OpenFDs), name))
+			diskIO = append(diskIO,
+				deltaPoint(float64(p.ReadBPS)*elapsed, name, otlpAttr("disk.io.direction", "read")),
+				deltaPoint(float64(p.WriteBPS)*elapsed, name, otlpAttr("disk.io.direction", "write")))
+			uptime = append(uptime, point(float64(p.UptimeSeconds), name))
+		}
+		metrics = append(metrics,
+			upDownCounter("host_monitor.process.instances", "{process}", instances...),
+			gauge("host_monitor.process.cpu.utilization", "1", cpu...),
+			upDownCounter("host_monitor.process.memory.usage", "By", memory...),
+			upDownCounter("host_monitor.process.thread.count", "{thread}", threads...),
+			upDownCounter("host_monitor.process.open_file_descriptor.count", "{file_descriptor}", fds...),
+			deltaCounter("host_monitor.process.disk.io", "By", diskIO...),
+			gauge("host_monitor.process.uptime", "s", uptime...))
+	}
+
+	if len(fsInodes) > 0 {
+		metrics = append(metrics, upDownCounter("system.filesystem.inodes.usage", "{inode}", fsInodes...))
+	}
+
+	if len(m.DiskIO) > 0 {
+		var diskIO, diskOperations, await, utilization []otlpDataPoint
+		for _, d := range m.DiskIO {
+			device := otlpAttr("system.device", d.Device)
+			read, write := otlpAttr("disk.io.direction", "read"), otlpAttr("disk.io.direction", "write")
+			diskIO = append(diskIO, deltaPoint(float64(d.ReadBPS)*elapsed, device, read), deltaPoint(float64(d.WriteBPS)*elapsed, device, write))
+			diskOperations = append(diskOperations, deltaPoint(d.ReadIOPS*elapsed, device, read), deltaPoint(d.WriteIOPS*elapsed, device, write))
+			await = append(await, point(d.AwaitMS, device))
+			utilization = append(utilization, point(d.UtilPercent/100, device))
+		}
+		metrics = append(metrics,
+			deltaCounter("system.disk.io", "By", diskIO...),
+			deltaCounter("system.disk.operations", "{operation}", diskOperations...),
+			gauge("host_monitor.disk.await", "ms", await...),
+			gauge("host_monitor.disk.utilization", "1", utilization...))
+	}
+
+	// Without an interval, e.g. in spooled events of older versions, the
+	// amounts and the start time of the delta points are unknown
+	if elapsed <= 0 {
+		metrics = slices.DeleteFunc(metrics, func(metric otlpMetric) bool {
+			return metric.Sum != nil && metric.Sum.AggregationTemporality == otlpTemporalityDelta
+		})
+	}
+
+	return otlpExportRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			otlpAttr("host.name", m.Hostname),
+			otlpAttr("service.name", "host-monitor"),
+		}},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: "host-monitor"},
+			Metrics: metrics,
+		}},
+	}}}
+}
+
+// otlpCPUModePoints returns one data point per CPU mode, with the core as
+// attribute unless core is empty.
+func otlpCPUModePoints(point func(float64, ...otlpKeyValue) otlpDataPoint, core string, modes CPUModes) []otlpDataPoint {
+	var points []otlpDataPoint
+	for _, v := range modes.values() {
+		attrs := []otlpKeyValue{otlpAttr("cpu.mode", v.mode)}
+		if core != "" {
+			attrs = append([]otlpKeyValue{otlpAttr("cpu", core)}, attrs...)
+		}
+		points = append(points, point(v.value/100, attrs...))
+	}
+	return points
+}
+
+func otlpNanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpAttr(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: value}}
+}
+
+// The following types mirror the OTLP metrics data model. Their JSON tags
+// follow the OTLP/JSON mapping, marshalProto implements the protobuf wire
+// format of opentelemetry/proto/collector/metrics/v1.
+
+type otlpExportRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Unit  string     `json:"unit,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic,omitempty"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          float64        `json:"asDouble"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func (r otlpExportRequest) marshalProto() []byte {
+	var b []byte
+	for _, rm := range r.ResourceMetrics {
+		b = protoAppendMessage(b, 1, rm.marshalProto())
+	}
+	return b
+}
+
+func (rm otlpResourceMetrics) marshalProto() []byte {
+	var resource []byte
+	for _, attr := range rm.Resource.Attributes {
+		resource = protoAppendMessage(resource, 1, attr.marshalProto())
+	}
+
+	b := protoAppendMessage(nil, 1, resource)
+	for _, sm := range rm.ScopeMetrics {
+		b = protoAppendMessage(b, 2, sm.marshalProto())
+	}
+	return b
+}
+
+func (sm otlpScopeMetrics) marshalProto() []byte {
+	b := protoAppendMessage(nil, 1, protoAppendString(nil, 1, sm.Scope.Name))
+	for _, metric := range sm.Metrics {
+		b = protoAppendMessage(b, 2, metric.marshalProto())
+	}
+	return b
+}
+
+func (m otlpMetric) marshalProto() []byte {
+	b := protoAppendString(nil, 1, m.Name)
+	b = protoAppendString(b, 3, m.Unit)
+
+	var points []byte
+	switch {
+	case m.Gauge != nil:
+		for _, p := range m.Gauge.DataPoints {
+			points = protoAppendMessage(points, 1, p.marshalProto())
+		}
+		b = protoAppendMessage(b, 5, points)
+	case m.Sum != nil:
+		for _, p := range m.Sum.DataPoints {
+			points = protoAppendMessage(points, 1, p.marshalProto())
+		}
+		points = protoAppendVarint(points, 2, uint64(m.Sum.AggregationTemporality))
+		if m.Sum.IsMonotonic {
+			points = protoAppendVarint(points, 3, 1)
+		}
+		b = protoAppendMessage(b, 7, points)
+	}
+	return b
+}
+
+func (p otlpDataPoint) marshalProto() []byte {
+	var b []byte
+	if p.StartTimeUnixNano != "" {
+		start, _ := strconv.ParseUint(p.StartTimeUnixNano, 10, 64)
+		b = protoAppendFixed64(b, 2, start)
+	}
+	ts, _ := strconv.ParseUint(p.TimeUnixNano, 10, 64)
+	b = protoAppendFixed64(b, 3, ts)
+	b = protoAppendFixed64(b, 4, math.Float64bits(p.AsDouble))
+	for _, attr := range p.Attributes {
+		b = protoAppendMessage(b, 7, attr.marshalProto())
+	}
+	return b
+}
+
+func (kv otlpKeyValue) marshalProto() []byte {
+	b := protoAppendString(nil, 1, kv.Key)
+	return protoAppendMessage(b, 2, protoAppendString(nil, 1, kv.Value.StringValue))
+}
+
+// Minimal protobuf wire format helpers
+
+func protoAppendTag(b []byte, field int, wireType byte) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func protoAppendVarint(b []byte, field int, value uint64) []byte {
+	b = protoAppendTag(b, field, 0)
+	return binary.AppendUvarint(b, value)
+}
+
+func protoAppendFixed64(b []byte, field int, value uint64) []byte {
+	b = protoAppendTag(b, field, 1)
+	return binary.LittleEndian.AppendUint64(b, value)
+}
+
+func protoAppendMessage(b []byte, field int, msg []byte) []byte {
+	b = protoAppendTag(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(msg)))
+	return append(b, msg...)
+}
+
+func protoAppendString(b []byte, field int, value string) []byte {
+	if value == "" {
+		return b
+	}
+	return protoAppendMessage(b, field, []byte(value))
+}
+
+// otlpConnectionState maps the Linux TCP state names to the values of the
+// network.connection.state attribute.
+func otlpConnectionState(state string) string {
+	switch state {
+	case "SYN_RECV":
+		return "syn_received"
+	case "FIN_WAIT1":
+		return "fin_wait_1"
+	case "FIN_WAIT2":
+		return "fin_wait_2"
+	case "CLOSE":
+		return "closed"
+	}
+	return strings.ToLower(state)
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The expected bytes are derived by hand from the field numbers in
+// opentelemetry/proto/metrics/v1/metrics.proto.
+
+func TestOTLPMarshalProtoGauge(t *testing.T) {
+	request := otlpExportRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{otlpAttr("h", "x")}},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope: otlpScope{Name: "s"},
+			Metrics: []otlpMetric{{
+				Name: "m",
+				Unit: "1",
+				Gauge: &otlpGauge{DataPoints: []otlpDataPoint{{
+					TimeUnixNano: "1",
+					AsDouble:     0.5,
+					Attributes:   []otlpKeyValue{otlpAttr("h", "x")},
+				}}},
+			}},
+		}},
+	}}}
+
+	keyValue := []byte{
+		0x0a, 0x01, 'h', // key = 1
+		0x12, 0x03, // value = 2, AnyValue
+		0x0a, 0x01, 'x', // string_value = 1
+	}
+
+	var want []byte
+	want = append(want, 0x0a, 0x3b) // ExportMetricsServiceRequest.resource_metrics = 1
+	want = append(want, 0x0a, 0x0a) // ResourceMetrics.resource = 1
+	want = append(want, 0x0a, 0x08) // Resource.attributes = 1
+	want = append(want, keyValue...)
+	want = append(want, 0x12, 0x2d)                         // ResourceMetrics.scope_metrics = 2
+	want = append(want, 0x0a, 0x03)                         // ScopeMetrics.scope = 1
+	want = append(want, 0x0a, 0x01, 's')                    // InstrumentationScope.name = 1
+	want = append(want, 0x12, 0x26)                         // ScopeMetrics.metrics = 2
+	want = append(want, 0x0a, 0x01, 'm')                    // Metric.name = 1
+	want = append(want, 0x1a, 0x01, '1')                    // Metric.unit = 3
+	want = append(want, 0x2a, 0x1e)                         // Metric.gauge = 5
+	want = append(want, 0x0a, 0x1c)                         // Gauge.data_points = 1
+	want = append(want, 0x19, 1, 0, 0, 0, 0, 0, 0, 0)       // time_unix_nano = 3, fixed64
+	want = append(want, 0x21, 0, 0, 0, 0, 0, 0, 0xe0, 0x3f) // as_double = 4, 0.5
+	want = append(want, 0x3a, 0x08)                         // attributes = 7
+	want = append(want, keyValue...)
+
+	if got := request.marshalProto(); !bytes.Equal(got, want) {
+		t.Errorf("marshalProto() =\n% x\nwant\n% x", got, want)
+	}
+}
+
+func TestOTLPMarshalProtoSum(t *testing.T) {
+	metric := otlpMetric{
+		Name: "n",
+		Sum: &otlpSum{
+			DataPoints:             []otlpDataPoint{{StartTimeUnixNano: "1", TimeUnixNano: "2"}},
+			AggregationTemporality: otlpTemporalityDelta,
+			IsMonotonic:            true,
+		},
+	}
+
+	var want []byte
+	want = append(want, 0x0a, 0x01, 'n')              // Metric.name = 1, empty unit omitted
+	want = append(want, 0x3a, 0x21)                   // Metric.sum = 7
+	want = append(want, 0x0a, 0x1b)                   // Sum.data_points = 1
+	want = append(want, 0x11, 1, 0, 0, 0, 0, 0, 0, 0) // start_time_unix_nano = 2, fixed64
+	want = append(want, 0x19, 2, 0, 0, 0, 0, 0, 0, 0) // time_unix_nano = 3, fixed64
+	want = append(want, 0x21, 0, 0, 0, 0, 0, 0, 0, 0) // as_double = 4
+	want = append(want, 0x10, 0x01)                   // Sum.aggregation_temporality = 2, DELTA
+	want = append(want, 0x18, 0x01)                   // Sum.is_monotonic = 3
+
+	if got := metric.marshalProto(); !bytes.Equal(got, want) {
+		t.Errorf("marshalProto() =\n% x\nwant\n% x", got, want)
+	}
+}
+
+func TestOTLPProtoVarintLength(t *testing.T) {
+	// Messages of 128 bytes and more need a two-byte length prefix
+	name := string(bytes.Repeat([]byte("a"), 200))
+	got := protoAppendString(nil, 1, name)
+	if !bytes.Equal(got[:3], []byte{0x0a, 0xc8, 0x01}) || len(got) != 203 {
+		t.Errorf("prefix = % x, length %d", got[:3], len(got))
+	}
+}
+
+func TestOTLPJSONMapping(t *testing.T) {
+	point := otlpDataPoint{TimeUnixNano: "1792217700000000000", AsDouble: 0.5}
+	data, err := json.Marshal(point)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 64-bit integers are strings in OTLP/JSON
+	if want := `{"timeUnixNano":"1792217700000000000","asDouble":0.5}`; string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
+
+func TestOTLPCPUUtilization(t *testing.T) {
+	s := &otlpSink{}
+	request := s.buildRequest(SystemMetrics{
+		CPUPercent: 20,
+		CPUModes:   &CPUModes{User: 15, Idle: 80},
+		CPUCores:   []CPUCoreUsage{{Core: "cpu0", Percent: 40, CPUModes: CPUModes{User: 40}}},
+	})
+
+	metrics := request.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if metrics[0].Name != "system.cpu.utilization" || metrics[1].Name != "host_monitor.cpu.usage" {
+		t.Fatalf("first metrics are %s and %s", metrics[0].Name, metrics[1].Name)
+	}
+
+	// With cores known there are only points per core
+	values := otlpTestPointValues(metrics[0])
+	want := map[string]float64{
+		"cpu=cpu0,cpu.mode=user":    0.4,
+		"cpu=cpu0,cpu.mode=softirq": 0,
+	}
+	for key, value := range want {
+		if got, ok := values[key]; !ok || got != value {
+			t.Errorf("point {%s} = %v (present %t), want %v", key, got, ok, value)
+		}
+	}
+	if len(values) != 10 {
+		t.Errorf("got %d data points, want the 10 modes of cpu0", len(values))
+	}
+	if usage := otlpTestPointValues(metrics[1]); len(usage) != 1 || usage["cpu=cpu0"] != 0.4 {
+		t.Errorf("usage = %v", usage)
+	}
+}
+
+func TestOTLPCPUUtilizationWithoutCores(t *testing.T) {
+	tests := []struct {
+		name        string
+		m           SystemMetrics
+		utilization map[string]float64
+	}{
+		{
+			name:        "modes",
+			m:           SystemMetrics{CPUPercent: 20, CPUModes: &CPUModes{User: 15, Idle: 80}},
+			utilization: map[string]float64{"cpu.mode=user": 0.15, "cpu.mode=idle": 0.8},
+		},
+		{
+			name:        "usage only",
+			m:           SystemMetrics{CPUPercent: 20},
+			utilization: map[string]float64{"": 0.2},
+		},
+	}
+	for _, tt := range tests {
+		metrics := (&otlpSink{}).buildRequest(tt.m).ResourceMetrics[0].ScopeMetrics[0].Metrics
+		values := otlpTestPointValues(metrics[0])
+		for key, value := range tt.utilization {
+			if got, ok := values[key]; !ok || got != value {
+				t.Errorf("%s: point {%s} = %v (present %t), want %v", tt.name, key, got, ok, value)
+			}
+		}
+		if _, ok := values[""]; ok && tt.m.CPUModes != nil {
+			t.Errorf("%s: usage point next to the modes", tt.name)
+		}
+		if usage := otlpTestPointValues(metrics[1]); len(usage) != 1 || usage[""] != 0.2 {
+			t.Errorf("%s: usage = %v", tt.name, usage)
+		}
+	}
+}
+
+// otlpTestPointValues returns the values of a metric by their attributes,
+// e.g. "cpu=cpu0,cpu.mode=user".
+func otlpTestPointValues(metric otlpMetric) map[string]float64 {
+	var points []otlpDataPoint
+	if metric.Gauge != nil {
+		points = metric.Gauge.DataPoints
+	} else if metric.Sum != nil {
+		points = metric.Sum.DataPoints
+	}
+	values := make(map[string]float64)
+	for _, p := range points {
+		var key []string
+		for _, attr := range p.Attributes {
+			key = append(key, attr.Key+"="+attr.Value.StringValue)
+		}
+		values[strings.Join(key, ",")] = p.AsDouble
+	}
+	return values
+}
+
+func TestOTLPLoad(t *testing.T) {
+	s := &otlpSink{}
+	request := s.buildRequest(SystemMetrics{
+		Timestamp:     "2026-10-17T06:15:00Z",
+		LoadAverage5:  1.5,
+		LoadPerCPU15:  0.25,
+		ProcsRunning:  3,
+		ProcsBlocked:  1,
+		UptimeSeconds: 3600,
+	})
+
+	metrics := make(map[string]otlpMetric)
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[metric.Name] = metric
+	}
+
+	want := map[string]map[string]float64{
+		"system.cpu.load_average.5m":    {"": 1.5},
+		"host_monitor.load_per_cpu.15m": {"": 0.25},
+		"system.processes.count":        {"status=running": 3, "status=blocked": 1},
+		"system.uptime":                 {"": 3600},
+	}
+	for name, points := range want {
+		got := otlpTestPointValues(metrics[name])
+		if len(got) != len(points) {
+			t.Errorf("%s = %v, want %v", name, got, points)
+			continue
+		}
+		for key, value := range points {
+			if got[key] != value {
+				t.Errorf("%s{%s} = %v, want %v", name, key, got[key], value)
+			}
+		}
+	}
+}
+
+func TestOTLPFilesystems(t *testing.T) {
+	s := &otlpSink{}
+	request := s.buildRequest(SystemMetrics{
+		DiskPercent: 50,
+		Disks: []DiskUsage{{
+			Path: "/data", Device: "/dev/sdb1", FSType: "xfs",
+			Percent: 25, UsedBytes: 1, FreeBytes: 3, InodesTotal: 10, InodesFree: 4,
+		}},
+	})
+
+	points := make(map[string][]otlpDataPoint)
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		switch {
+		case metric.Gauge != nil:
+			points[metric.Name] = metric.Gauge.DataPoints
+		case metric.Sum != nil:
+			points[metric.Name] = metric.Sum.DataPoints
+		}
+	}
+
+	// The filesystems replace the unlabelled Disk_Percent point
+	if p := points["system.filesystem.utilization"]; len(p) != 1 || p[0].AsDouble != 0.25 || len(p[0].Attributes) != 3 {
+		t.Errorf("utilization = %+v", p)
+	}
+	usage := points["system.filesystem.usage"]
+	if len(usage) != 2 || usage[0].AsDouble != 1 || usage[1].AsDouble != 3 {
+		t.Fatalf("usage = %+v", usage)
+	}
+	if attrs := usage[0].Attributes; len(attrs) != 4 || attrs[3].Value.StringValue != "used" || usage[1].Attributes[3].Value.StringValue != "free" {
+		t.Errorf("usage attributes = %+v / %+v", attrs, usage[1].Attributes)
+	}
+	if inodes := points["system.filesystem.inodes.usage"]; len(inodes) != 2 || inodes[0].AsDouble != 6 || inodes[1].AsDouble != 4 {
+		t.Errorf("inodes = %+v", inodes)
+	}
+}
+
+func TestOTLPDiskIO(t *testing.T) {
+	start := time.Date(2026, 10, 17, 6, 14, 0, 0, time.UTC)
+	s := &otlpSink{}
+	request := s.buildRequest(SystemMetrics{
+		Timestamp:       "2026-10-17T06:15:00Z",
+		IntervalSeconds: 60,
+		DiskIO:          []DiskIOUsage{{Device: "sda", ReadBPS: 100, WriteIOPS: 2, AwaitMS: 4}},
+	})
+
+	metrics := make(map[string]otlpMetric)
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[metric.Name] = metric
+	}
+
+	// Rates are multiplied with the 60 seconds since the previous sample
+	io := metrics["system.disk.io"].Sum
+	if io == nil || io.AggregationTemporality != otlpTemporalityDelta || len(io.DataPoints) != 2 {
+		t.Fatalf("system.disk.io = %+v", io)
+	}
+	if p := io.DataPoints[0]; p.AsDouble != 6000 || p.StartTimeUnixNano != otlpNanos(start) ||
+		p.Attributes[0] != otlpAttr("system.device", "sda") || p.Attributes[1] != otlpAttr("disk.io.direction", "read") {
+		t.Errorf("read point = %+v", p)
+	}
+	if p := metrics["system.disk.operations"].Sum.DataPoints[1]; p.AsDouble != 120 {
+		t.Errorf("write operations = %v, want 120", p.AsDouble)
+	}
+	if p := metrics["host_monitor.disk.await"].Gauge.DataPoints[0]; p.AsDouble != 4 {
+		t.Errorf("await = %v, want 4", p.AsDouble)
+	}
+}
+
+func TestOTLPDeltaInterval(t *testing.T) {
+	s := &otlpSink{}
+	m := SystemMetrics{
+		Timestamp:       "2026-10-17T06:15:00Z",
+		IntervalSeconds: 14.5,
+		NetworkRXBPS:    1000,
+		NetworkRXErrors: 3,
+	}
+
+	// The interval of the event sets the amount and the start, independent
+	// of when the sink was created or sent the previous event
+	for i := 0; i < 2; i++ {
+		metrics := make(map[string]otlpMetric)
+		for _, metric := range s.buildRequest(m).ResourceMetrics[0].ScopeMetrics[0].Metrics {
+			metrics[metric.Name] = metric
+		}
+		end := time.Date(2026, 10, 17, 6, 15, 0, 0, time.UTC)
+		io := metrics["system.network.io"].Sum
+		if io == nil || !io.IsMonotonic || io.AggregationTemporality != otlpTemporalityDelta {
+			t.Fatalf("system.network.io = %+v", io)
+		}
+		p := io.DataPoints[0]
+		if p.AsDouble != 14500 {
+			t.Errorf("rx amount = %v, want 14500", p.AsDouble)
+		}
+		if p.StartTimeUnixNano != otlpNanos(end.Add(-14500*time.Millisecond)) || p.TimeUnixNano != otlpNanos(end) {
+			t.Errorf("rx point covers %s to %s", p.StartTimeUnixNano, p.TimeUnixNano)
+		}
+		if p := metrics["system.network.errors"].Sum.DataPoints[0]; p.AsDouble != 3 || p.StartTimeUnixNano != io.DataPoints[0].StartTimeUnixNano {
+			t.Errorf("rx errors point = %+v", p)
+		}
+	}
+
+	// Without an interval no delta points are sent
+	m.IntervalSeconds = 0
+	for _, metric := range s.buildRequest(m).ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if metric.Sum != nil && metric.Sum.AggregationTemporality == otlpTemporalityDelta {
+			t.Errorf("delta counter %s without interval", metric.Name)
+		}
+	}
+}
+
+func TestOTLPNetwork(t *testing.T) {
+	start := time.Date(2026, 10, 17, 6, 14, 0, 0, time.UTC)
+	s := &otlpSink{}
+	request := s.buildRequest(SystemMetrics{
+		Timestamp:         "2026-10-17T06:15:00Z",
+		IntervalSeconds:   60,
+		NetworkRXPPS:      5,
+		NetworkTXErrors:   3,
+		NetworkInterfaces: []NetworkInterfaceUsage{{Interface: "eth0", RXBPS: 100, RXPPS: 5, TXErrors: 3}},
+	})
+
+	metrics := make(map[string]otlpMetric)
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[metric.Name] = metric
+	}
+
+	// The values per interface replace the host-wide sum
+	packets := metrics["system.network.packets"].Sum
+	if packets == nil || packets.AggregationTemporality != otlpTemporalityDelta || len(packets.DataPoints) != 2 {
+		t.Fatalf("system.network.packets = %+v", packets)
+	}
+	if p := packets.DataPoints[0]; p.AsDouble != 300 || p.Attributes[0] != otlpAttr("network.interface.name", "eth0") {
+		t.Errorf("eth0 receive packets = %+v", p)
+	}
+	if p := metrics["system.network.io"].Sum.DataPoints[0]; p.AsDouble != 6000 ||
+		p.Attributes[0] != otlpAttr("network.interface.name", "eth0") || p.Attributes[1] != otlpAttr("network.io.direction", "receive") {
+		t.Errorf("eth0 receive point = %+v", p)
+	}
+
+	// Errors are already counted since the previous sample
+	errors := metrics["system.network.errors"].Sum
+	if p := errors.DataPoints[1]; p.AsDouble != 3 || p.StartTimeUnixNano != otlpNanos(start) {
+		t.Errorf("eth0 transmit errors = %+v", p)
+	}
+
+	// Without values per interface the sum has no interface attribute
+	request = s.buildRequest(SystemMetrics{Timestamp: "2026-10-17T06:16:00Z", NetworkRXPPS: 5})
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if metric.Name != "system.network.packets" {
+			continue
+		}
+		if p := metric.Sum.DataPoints[0]; len(metric.Sum.DataPoints) != 2 || p.AsDouble != 300 || len(p.Attributes) != 1 {
+			t.Errorf("host-wide packets = %+v", metric.Sum.DataPoints)
+		}
+	}
+}
+
+func TestOTLPSockets(t *testing.T) {
+	s := &otlpSink{}
+	request := s.buildRequest(SystemMetrics{
+		Timestamp:      "2026-10-17T06:15:00Z",
+		TCPConnections: 6,
+		TCPStates:      map[string]int{"ESTABLISHED": 4, "SYN_RECV": 2},
+		UDPSockets:     5,
+		ListeningPorts: []ListeningPort{{Protocol: "tcp", Address: "0.0.0.0", Port: 22, PID: 1, Process: "sshd"}},
+	})
+
+	metrics := make(map[string]otlpMetric)
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[metric.Name] = metric
+	}
+
+	// The TCP states replace the total, UDP follows without state
+	connections := metrics["system.network.connections"].Sum.DataPoints
+	if len(connections) != 3 {
+		t.Fatalf("got %d connection points, want 3", len(connections))
+	}
+	if p := connections[1]; p.AsDouble != 2 || p.Attributes[1] != otlpAttr("network.connection.state", "syn_received") {
+		t.Errorf("SYN_RECV point = %+v", p)
+	}
+	if p := connections[2]; p.AsDouble != 5 || len(p.Attributes) != 1 || p.Attributes[0] != otlpAttr("network.transport", "udp") {
+		t.Errorf("UDP point = %+v", p)
+	}
+
+	ports := metrics["host_monitor.listening_port"].Gauge
+	if ports == nil || len(ports.DataPoints) != 1 {
+		t.Fatalf("host_monitor.listening_port = %+v", ports)
+	}
+	if p := ports.DataPoints[0]; p.AsDouble != 1 || p.Attributes[2] != otlpAttr("network.local.port", "22") ||
+		p.Attributes[3] != otlpAttr("process.executable.name", "sshd") {
+		t.Errorf("port point = %+v", p)
+	}
+}
+
+func TestOTLPProcesses(t *testing.T) {
+	s := &otlpSink{}
+	request := s.buildRequest(SystemMetrics{
+		Timestamp:       "2026-10-17T06:15:00Z",
+		IntervalSeconds: 60,
+		Processes:       []ProcessUsage{{Name: "nginx", Instances: 4, CPUPercent: 150, WriteBPS: 10}},
+	})
+
+	metrics := make(map[string]otlpMetric)
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[metric.Name] = metric
+	}
+
+	name := otlpAttr("process.executable.name", "nginx")
+	if p := metrics["host_monitor.process.instances"].Sum.DataPoints[0]; p.AsDouble != 4 || p.Attributes[0] != name {
+		t.Errorf("instances point = %+v", p)
+	}
+	if p := metrics["host_monitor.process.cpu.utilization"].Gauge.DataPoints[0]; p.AsDouble != 1.5 {
+		t.Errorf("cpu utilization = %v, want 1.5", p.AsDouble)
+	}
+	io := metrics["host_monitor.process.disk.io"].Sum
+	if io == nil || io.AggregationTemporality != otlpTemporalityDelta || len(io.DataPoints) != 2 {
+		t.Fatalf("host_monitor.process.disk.io = %+v", io)
+	}
+	if p := io.DataPoints[1]; p.AsDouble != 600 || p.Attributes[1] != otlpAttr("disk.io.direction", "write") {
+		t.Errorf("write point = %+v", p)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PortCheck is an entry of the ports list in config.json, a port that is
+// expected to be listening.
+type PortCheck struct {
+	Protocol string `json:"protocol"` // "tcp" (default) or "udp"
+	Port     uint32 `json:"port"`
+	Address  string `json:"address"` // optional bind address
+	Process  string `json:"process"` // optional owning process
+}
+
+type PortCheckResult struct {
+	MissingCount int
+	Missing      []string
+}
+
+// String returns the name used in Ports_Missing, e.g. "tcp/127.0.0.1:5432".
+func (c PortCheck) String() string {
+	name := c.protocol() + "/"
+	if c.Address != "" {
+		if strings.Contains(c.Address, ":") {
+			name += "[" + c.Address + "]:"
+		} else {
+			name += c.Address + ":"
+		}
+	}
+	name += strconv.FormatUint(uint64(c.Port), 10)
+	if c.Process != "" {
+		name += " (" + c.Process + ")"
+	}
+	return name
+}
+
+func (c PortCheck) protocol() string {
+	if c.Protocol == "" {
+		return "tcp"
+	}
+	return strings.ToLower(c.Protocol)
+}
+
+// matches reports whether a listening socket satisfies the check. A socket
+// bound to the wildcard address also accepts connections on the configured
+// address, "::" usually for IPv4 as well.
+func (c PortCheck) matches(port ListeningPort) bool {
+	if port.Protocol != c.protocol() || port.Port != c.Port {
+		return false
+	}
+	if c.Address != "" && port.Address != c.Address && port.Address != "::" &&
+		!(port.Address == "0.0.0.0" && !strings.Contains(c.Address, ":")) {
+		return false
+	}
+	if c.Process != "" && !port.ownedBy(c.Process) {
+		return false
+	}
+	return true
+}
+
+// ownedBy reports whether any of the processes sharing the socket has the
+// given name.
+func (p ListeningPort) ownedBy(name string) bool {
+	name = normalizeProcessName(name)
+	if normalizeProcessName(p.Process) == name {
+		return true
+	}
+	for _, process := range p.processes {
+		if normalizeProcessName(process) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// portChecksNeedProcesses reports whether any check requires the process
+// names of the listening sockets.
+func portChecksNeedProcesses(config *Config) bool {
+	if config == nil {
+		return false
+	}
+	for _, check := range config.Ports {
+		if check.Process != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func checkPorts(config *Config, listening []ListeningPort) PortCheckResult {
+	// If no ports configured, return 0 missing
+	if config == nil || len(config.Ports) == 0 {
+		return PortCheckResult{
+			MissingCount: 0,
+			Missing:      []string{},
+		}
+	}
+
+	missing := []string{}
+	for _, check := range config.Ports {
+		found := false
+		for _, port := range listening {
+			if check.matches(port) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, check.String())
+		}
+	}
+
+	return PortCheckResult{
+		MissingCount: len(missing),
+		Missing:      missing,
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+func TestPortCheckMatches(t *testing.T) {
+	sshd := ListeningPort{Protocol: "tcp", Address: "0.0.0.0", Port: 22, PID: 812, Process: "sshd"}
+	postgres := ListeningPort{Protocol: "tcp", Address: "127.0.0.1", Port: 5432, PID: 900, Process: "postgres"}
+	dns := ListeningPort{Protocol: "udp", Address: "::", Port: 53, PID: 700, Process: "dnsmasq"}
+	// Socket activated by systemd, the service shares the socket
+	activated := ListeningPort{Protocol: "tcp", Address: "::", Port: 8080, PID: 1, Process: "systemd",
+		pids: []int32{1, 4711}, processes: []string{"systemd", "myservice"}}
+
+	tests := []struct {
+		name  string
+		check PortCheck
+		port  ListeningPort
+		want  bool
+	}{
+		{"port", PortCheck{Port: 22}, sshd, true},
+		{"other port", PortCheck{Port: 2222}, sshd, false},
+		{"tcp by default", PortCheck{Port: 53}, dns, false},
+		{"protocol", PortCheck{Protocol: "udp", Port: 53}, dns, true},
+		{"protocol case", PortCheck{Protocol: "UDP", Port: 53}, dns, true},
+		{"wrong protocol", PortCheck{Protocol: "udp", Port: 22}, sshd, false},
+		{"address", PortCheck{Port: 5432, Address: "127.0.0.1"}, postgres, true},
+		{"other address", PortCheck{Port: 5432, Address: "10.0.0.5"}, postgres, false},
+		{"IPv4 wildcard", PortCheck{Port: 22, Address: "10.0.0.5"}, sshd, true},
+		{"IPv4 wildcard for IPv6 address", PortCheck{Port: 22, Address: "fe80::1"}, sshd, false},
+		{"IPv6 wildcard", PortCheck{Protocol: "udp", Port: 53, Address: "10.0.0.5"}, dns, true},
+		{"IPv6 wildcard for IPv6 address", PortCheck{Protocol: "udp", Port: 53, Address: "::1"}, dns, true},
+		{"process", PortCheck{Port: 5432, Process: "postgres"}, postgres, true},
+		{"process case", PortCheck{Port: 5432, Process: "Postgres"}, postgres, true},
+		{"other process", PortCheck{Port: 5432, Process: "mysqld"}, postgres, false},
+		{"process unknown", PortCheck{Port: 22, Process: "sshd"}, ListeningPort{Protocol: "tcp", Address: "0.0.0.0", Port: 22}, false},
+		{"first owning process", PortCheck{Port: 8080, Process: "systemd"}, activated, true},
+		{"other owning process", PortCheck{Port: 8080, Process: "myservice"}, activated, true},
+		{"no owning process", PortCheck{Port: 8080, Process: "nginx"}, activated, false},
+	}
+	for _, tt := range tests {
+		if got := tt.check.matches(tt.port); got != tt.want {
+			t.Errorf("%s: %v matches %+v = %t, want %t", tt.name, tt.check, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestPortCheckString(t *testing.T) {
+	tests := []struct {
+		check PortCheck
+		want  string
+	}{
+		{PortCheck{Port: 443}, "tcp/443"},
+		{PortCheck{Protocol: "UDP", Port: 53}, "udp/53"},
+		{PortCheck{Port: 5432, Address: "127.0.0.1", Process: "postgres"}, "tcp/127.0.0.1:5432 (postgres)"},
+		{PortCheck{Port: 8080, Address: "::1"}, "tcp/[::1]:8080"},
+	}
+	for _, tt := range tests {
+		if got := tt.check.String(); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.check, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPorts(t *testing.T) {
+	config := &Config{Ports: []PortCheck{
+		{Port: 22},
+		{Port: 5432, Address: "127.0.0.1", Process: "postgres"},
+		{Protocol: "udp", Port: 53},
+	}}
+	listening := []ListeningPort{
+		{Protocol: "tcp", Address: "0.0.0.0", Port: 22, Process: "sshd"},
+		{Protocol: "tcp", Address: "127.0.0.1", Port: 5432, Process: "pgbouncer"},
+	}
+
+	result := checkPorts(config, listening)
+	want := []string{"tcp/127.0.0.1:5432 (postgres)", "udp/53"}
+	if result.MissingCount != 2 || !slices.Equal(result.Missing, want) {
+		t.Errorf("missing = %d %q, want %q", result.MissingCount, result.Missing, want)
+	}
+
+	if result := checkPorts(&Config{}, listening); result.MissingCount != 0 || len(result.Missing) != 0 {
+		t.Errorf("without checks: %+v", result)
+	}
+}
+
+func TestCountSocketsKeepsAllOwningProcesses(t *testing.T) {
+	listen := func(pid int32) net.ConnectionStat {
+		return net.ConnectionStat{Type: syscall.SOCK_STREAM, Family: syscall.AF_INET, Status: "LISTEN",
+			Laddr: net.Addr{IP: "0.0.0.0", Port: 80}, Pid: pid}
+	}
+	connections := []net.ConnectionStat{
+		listen(1201), listen(1200), listen(1202), listen(1201),
+		{Type: syscall.SOCK_STREAM, Family: syscall.AF_INET6, Status: "ESTABLISHED",
+			Laddr: net.Addr{IP: "::1", Port: 80}, Raddr: net.Addr{IP: "::1", Port: 40000}, Pid: 1201},
+		{Type: syscall.SOCK_DGRAM, Family: syscall.AF_INET, Laddr: net.Addr{IP: "0.0.0.0", Port: 53}},
+	}
+
+	stats := countSockets(connections)
+	if stats.TCP != 5 || stats.TCPIPv6 != 1 || stats.TCPStates["LISTEN"] != 4 || stats.UDP != 1 {
+		t.Errorf("counts = %+v", stats)
+	}
+	if len(stats.Listening) != 2 {
+		t.Fatalf("listening = %+v, want one socket per port", stats.Listening)
+	}
+	web := stats.Listening[0]
+	if web.Port != 80 || web.PID != 1200 || !slices.Equal(web.pids, []int32{1200, 1201, 1202}) {
+		t.Errorf("port 80 = %+v", web)
+	}
+
+	names := map[int32]string{1200: "nginx", 1201: "nginx", 1202: "nginx-helper"}
+	resolveListeningProcesses(stats.Listening, func(pid int32) string { return names[pid] })
+	if web := stats.Listening[0]; web.Process != "nginx" || !slices.Equal(web.processes, []string{"nginx", "nginx-helper"}) {
+		t.Errorf("port 80 processes = %q (%q)", web.Process, web.processes)
+	}
+	if dns := stats.Listening[1]; dns.Protocol != "udp" || dns.PID != 0 || dns.Process != "" {
+		t.Errorf("port 53 = %+v", dns)
+	}
+	if !(PortCheck{Port: 80, Process: "nginx-helper"}).matches(stats.Listening[0]) {
+		t.Error("check for the second process of a shared socket failed")
+	}
+}
+
+func TestNormalizeTCPState(t *testing.T) {
+	tests := map[string]string{
+		// Linux
+		"ESTABLISHED": "ESTABLISHED",
+		"SYN_SENT":    "SYN_SENT",
+		"SYN_RECV":    "SYN_RECV",
+		"FIN_WAIT1":   "FIN_WAIT1",
+		"FIN_WAIT2":   "FIN_WAIT2",
+		"TIME_WAIT":   "TIME_WAIT",
+		"CLOSE":       "CLOSE",
+		"CLOSE_WAIT":  "CLOSE_WAIT",
+		"LAST_ACK":    "LAST_ACK",
+		"LISTEN":      "LISTEN",
+		"CLOSING":     "CLOSING",
+		// Windows
+		"CLOSED":       "CLOSE",
+		"SYN_RECEIVED": "SYN_RECV",
+		"FIN_WAIT_1":   "FIN_WAIT1",
+		"FIN_WAIT_2":   "FIN_WAIT2",
+		"DELETE":       "CLOSE",
+		// macOS
+		"SYN_RCVD": "SYN_RECV",
+		// Unknown
+		"":             "UNKNOWN",
+		"NONE":         "UNKNOWN",
+		"NEW_SYN_RECV": "UNKNOWN",
+		"listen":       "UNKNOWN",
+	}
+	for status, want := range tests {
+		if got := normalizeTCPState(status); got != want {
+			t.Errorf("normalizeTCPState(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
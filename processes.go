@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcessCheck is an entry of the processes list in config.json. A plain
+// string is the executable name, an object may match on further criteria.
+// All given criteria must match.
+type ProcessCheck struct {
+	Name    string `json:"name"`    // used in Processes_Not_Running
+	Process string `json:"process"` // executable name, defaults to name if no other criterion is set
+	Cmdline string `json:"cmdline"` // regular expression matched against the command line
+	Exe     string `json:"exe"`     // executable path, may contain glob patterns
+	User    string `json:"user"`
+	Pidfile string `json:"pidfile"`
+
+	MinInstances *int `json:"min_instances"` // default 1
+	MaxInstances int  `json:"max_instances"` // 0 for no limit
+
+	cmdlineRe *regexp.Regexp
+}
+
+func (c *ProcessCheck) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*c = ProcessCheck{Name: name, Process: name}
+		return nil
+	}
+
+	type plain ProcessCheck
+	var check plain
+	if err := json.Unmarshal(data, &check); err != nil {
+		return err
+	}
+	*c = ProcessCheck(check)
+
+	if c.Process == "" && c.Cmdline == "" && c.Exe == "" && c.User == "" && c.Pidfile == "" {
+		c.Process = c.Name
+	}
+	if c.Name == "" {
+		c.Name = c.Process
+	}
+	if c.Name == "" {
+		return errors.New("Prozess ohne name")
+	}
+
+	if c.Cmdline != "" {
+		re, err := regexp.Compile(c.Cmdline)
+		if err != nil {
+			return fmt.Errorf("Prozess %s: ungültiger cmdline-Ausdruck: %w", c.Name, err)
+		}
+		c.cmdlineRe = re
+	}
+	return nil
+}
+
+// instancesOK reports whether the number of matching processes is within
+// the configured limits.
+func (c ProcessCheck) instancesOK(count int) bool {
+	minInstances := 1
+	if c.MinInstances != nil {
+		minInstances = *c.MinInstances
+	}
+	return count >= minInstances && !c.tooManyInstances(count)
+}
+
+// tooManyInstances reports whether more processes match than allowed by
+// max_instances. The process is running then, just too often.
+func (c ProcessCheck) tooManyInstances(count int) bool {
+	return c.MaxInstances > 0 && count > c.MaxInstances
+}
+
+// processCheckNames returns the names of the checks as reported in
+// Processes_Not_Running.
+func processCheckNames(checks []ProcessCheck) []string {
+	names := make([]string, len(checks))
+	for i, check := range checks {
+		names[i] = check.Name
+	}
+	return names
+}
+
+// processInfo holds the attributes of a running process needed by the
+// configured checks.
+type processInfo struct {
+	proc    *process.Process
+	name    string
+	cmdline string
+	exe     string
+	user    string
+}
+
+// matchProcesses returns the processes matching each check. Command line,
+// executable and user are only read if a check needs them.
+func matchProcesses(checks []ProcessCheck, processes []*process.Process) [][]*process.Process {
+	var needCmdline, needExe, needUser bool
+	pidfiles := make([]int32, len(checks))
+	for i, check := range checks {
+		needCmdline = needCmdline || check.cmdlineRe != nil
+		needExe = needExe || check.Exe != ""
+		needUser = needUser || check.User != ""
+
+		if check.Pidfile != "" {
+			// A missing or invalid pidfile matches no process
+			pidfiles[i] = -1
+			if data, err := os.ReadFile(check.Pidfile); err == nil {
+				if pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32); err == nil {
+					pidfiles[i] = int32(pid)
+				}
+			}
+		}
+	}
+
+	matches := make([][]*process.Process, len(checks))
+	for _, p := range processes {
+		info := processInfo{proc: p}
+		if name, err := p.Name(); err == nil {
+			info.name = normalizeProcessName(name)
+		}
+		if needCmdline {
+			info.cmdline, _ = p.Cmdline()
+		}
+		if needExe {
+			info.exe, _ = p.Exe()
+		}
+		if needUser {
+			info.user, _ = p.Username()
+		}
+
+		for i, check := range checks {
+			if check.matches(info, pidfiles[i]) {
+				matches[i] = append(matches[i], p)
+			}
+		}
+	}
+	return matches
+}
+
+func (c ProcessCheck) matches(info processInfo, pidfilePID int32) bool {
+	if c.Process != "" && (info.name == "" || info.name != normalizeProcessName(c.Process)) {
+		return false
+	}
+	if c.cmdlineRe != nil && !c.cmdlineRe.MatchString(info.cmdline) {
+		return false
+	}
+	if c.Exe != "" && !matchExecutablePath(c.Exe, info.exe) {
+		return false
+	}
+	if c.User != "" && !matchUsername(c.User, info.user) {
+		return false
+	}
+	if c.Pidfile != "" && info.proc.Pid != pidfilePID {
+		return false
+	}
+	return true
+}
+
+func matchExecutablePath(pattern, exe string) bool {
+	if exe == "" {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		pattern, exe = strings.ToLower(pattern), strings.ToLower(exe)
+	}
+	pattern, exe = filepath.Clean(pattern), filepath.Clean(exe)
+	if matched, _ := filepath.Match(pattern, exe); matched {
+		return true
+	}
+	return pattern == exe
+}
+
+// matchUsername compares user names, on Windows also without the domain.
+func matchUsername(want, user string) bool {
+	if user == "" {
+		return false
+	}
+	if runtime.GOOS != "windows" {
+		return user == want
+	}
+	if strings.EqualFold(user, want) {
+		return true
+	}
+	if i := strings.LastIndex(user, `\`); i >= 0 {
+		return strings.EqualFold(user[i+1:], want)
+	}
+	return false
+}
+
+// ProcessStats holds the processes matched by each configured check,
+// index-aligned with Config.Processes.
+type ProcessStats struct {
+	Available bool // false if the process list could not be read
+	Checks    []ProcessSample
+}
+
+// ProcessSample is the state of all instances matched by one check.
+type ProcessSample struct {
+	Instances  int
+	RSS        uint64
+	Threads    int
+	FDs        int
+	CreateTime int64 // of the oldest instance in Unix milliseconds
+	Counters   map[int32]ProcessCounters
+}
+
+// ProcessCounters are the cumulative counters of one process instance.
+type ProcessCounters struct {
+	CPUTime               float64 // user and system time in seconds
+	ReadBytes, WriteBytes uint64
+}
+
+// ProcessUsage is the resource usage of a monitored process, summed over
+// all of its instances.
+type ProcessUsage struct {
+	Name          string  `json:"Name"`
+	Instances     int     `json:"Instances"`
+	CPUPercent    float64 `json:"CPU_Percent"` // 100 per fully used core
+	RSSBytes      uint64  `json:"RSS_Bytes"`
+	Threads       int     `json:"Threads"`
+	OpenFDs       int     `json:"Open_FDs"` // not on Windows
+	ReadBPS       uint64  `json:"Read_BPS"`
+	WriteBPS      uint64  `json:"Write_BPS"`
+	UptimeSeconds uint64  `json:"Uptime_Seconds"` // of the oldest instance
+}
+
+// getProcessStats enumerates the running processes once and collects the
+// matches and resource counters for every configured check.
+func getProcessStats(config *Config) ProcessStats {
+	if config == nil || len(config.Processes) == 0 {
+		return ProcessStats{}
+	}
+
+	processes, err := process.Processes()
+	if err != nil {
+		logError("Fehler beim Abrufen der Prozesse: %v", err)
+		return ProcessStats{}
+	}
+
+	matches := matchProcesses(config.Processes, processes)
+	stats := ProcessStats{Available: true, Checks: make([]ProcessSample, len(matches))}
+	for i, procs := range matches {
+		sample := ProcessSample{
+			Instances: len(procs),
+			Counters:  make(map[int32]ProcessCounters, len(procs)),
+		}
+
+		for _, p := range procs {
+			// Attributes of processes owned by other users may not be
+			// readable without root, they are counted as 0
+			var counters ProcessCounters
+			if times, err := p.Times(); err == nil {
+				counters.CPUTime = times.User + times.System
+			}
+			if io, err := p.IOCounters(); err == nil {
+				counters.ReadBytes = io.ReadBytes
+				counters.WriteBytes = io.WriteBytes
+			}
+			sample.Counters[p.Pid] = counters
+
+			if memInfo, err := p.MemoryInfo(); err == nil {
+				sample.RSS += memInfo.RSS
+			}
+			if threads, err := p.NumThreads(); err == nil {
+				sample.Threads += int(threads)
+			}
+			if fds, err := p.NumFDs(); err == nil {
+				sample.FDs += int(fds)
+			}
+			if created, err := p.CreateTime(); err == nil && (sample.CreateTime == 0 || created < sample.CreateTime) {
+				sample.CreateTime = created
+			}
+		}
+
+		stats.Checks[i] = sample
+	}
+
+	return stats
+}
+
+// processUsages calculates the resource usage per check. CPU and I/O rates
+// only include instances that already existed at the previous sample.
+func processUsages(config *Config, prev, curr ProcessStats, timeDiff float64) []ProcessUsage {
+	if config == nil || !curr.Available {
+		return nil
+	}
+
+	now := time.Now()
+	usages := make([]ProcessUsage, 0, len(curr.Checks))
+	for i, sample := range curr.Checks {
+		usage := ProcessUsage{
+			Name:      config.Processes[i].Name,
+			Instances: sample.Instances,
+			RSSBytes:  sample.RSS,
+			Threads:   sample.Threads,
+			OpenFDs:   sample.FDs,
+		}
+		if sample.CreateTime > 0 {
+			if uptime := now.Sub(time.UnixMilli(sample.CreateTime)); uptime > 0 {
+				usage.UptimeSeconds = uint64(uptime.Seconds())
+			}
+		}
+
+		if timeDiff > 0 && prev.Available && i < len(prev.Checks) {
+			var cpuTime float64
+			var readBytes, writeBytes uint64
+			for pid, c := range sample.Counters {
+				p, found := prev.Checks[i].Counters[pid]
+				if !found {
+					continue
+				}
+				if c.CPUTime >= p.CPUTime {
+					cpuTime += c.CPUTime - p.CPUTime
+				}
+				if c.ReadBytes >= p.ReadBytes {
+					readBytes += c.ReadBytes - p.ReadBytes
+				}
+				if c.WriteBytes >= p.WriteBytes {
+					writeBytes += c.WriteBytes - p.WriteBytes
+				}
+			}
+			usage.CPUPercent = cpuTime / timeDiff * 100
+			usage.ReadBPS = uint64(float64(readBytes) / timeDiff)
+			usage.WriteBPS = uint64(float64(writeBytes) / timeDiff)
+		}
+
+		usages = append(usages, usage)
+	}
+	return usages
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+func TestProcessUsages(t *testing.T) {
+	config := &Config{Processes: []ProcessCheck{{Name: "nginx"}, {Name: "postgres"}}}
+	started := time.Now().Add(-time.Hour).UnixMilli()
+
+	prev := ProcessStats{Available: true, Checks: []ProcessSample{
+		{Counters: map[int32]ProcessCounters{
+			100: {CPUTime: 10, ReadBytes: 1000, WriteBytes: 2000},
+			101: {CPUTime: 50, ReadBytes: 9000},
+		}},
+		{Counters: map[int32]ProcessCounters{}},
+	}}
+	curr := ProcessStats{Available: true, Checks: []ProcessSample{
+		{
+			Instances:  3,
+			RSS:        4096,
+			Threads:    12,
+			FDs:        30,
+			CreateTime: started,
+			Counters: map[int32]ProcessCounters{
+				100: {CPUTime: 11, ReadBytes: 3000, WriteBytes: 6000},
+				// PID reused by a new process with lower counters
+				101: {CPUTime: 1, ReadBytes: 10},
+				// Started since the previous sample
+				102: {CPUTime: 30, ReadBytes: 1 << 30},
+			},
+		},
+		{Counters: map[int32]ProcessCounters{}},
+	}}
+
+	tests := []struct {
+		name     string
+		prev     ProcessStats
+		timeDiff float64
+		want     ProcessUsage
+	}{
+		{"rates", prev, 2, ProcessUsage{CPUPercent: 50, ReadBPS: 1000, WriteBPS: 2000}},
+		{"first sample", ProcessStats{}, 2, ProcessUsage{}},
+		{"no time passed", prev, 0, ProcessUsage{}},
+	}
+	for _, tt := range tests {
+		usages := processUsages(config, tt.prev, curr, tt.timeDiff)
+		if len(usages) != 2 {
+			t.Fatalf("%s: got %d usages, want 2", tt.name, len(usages))
+		}
+
+		got := usages[0]
+		if got.CPUPercent != tt.want.CPUPercent || got.ReadBPS != tt.want.ReadBPS || got.WriteBPS != tt.want.WriteBPS {
+			t.Errorf("%s: got CPU %v, read %d, write %d, want %+v", tt.name, got.CPUPercent, got.ReadBPS, got.WriteBPS, tt.want)
+		}
+		if got.Name != "nginx" || got.Instances != 3 || got.RSSBytes != 4096 || got.Threads != 12 || got.OpenFDs != 30 {
+			t.Errorf("%s: got %+v", tt.name, got)
+		}
+		if got.UptimeSeconds < 3600 || got.UptimeSeconds > 3660 {
+			t.Errorf("%s: uptime %d, want about 3600", tt.name, got.UptimeSeconds)
+		}
+		if usages[1].Name != "postgres" || usages[1].Instances != 0 || usages[1].UptimeSeconds != 0 {
+			t.Errorf("%s: got %+v for a check without instances", tt.name, usages[1])
+		}
+	}
+
+	if got := processUsages(config, prev, ProcessStats{}, 2); got != nil {
+		t.Errorf("without a process list got %+v, want nil", got)
+	}
+}
+
+func TestProcessCheckUnmarshalJSON(t *testing.T) {
+	four := 4
+	tests := []struct {
+		name    string
+		json    string
+		want    ProcessCheck
+		cmdline bool // a cmdline expression is compiled
+		wantErr bool
+	}{
+		{name: "plain string", json: `"nginx"`, want: ProcessCheck{Name: "nginx", Process: "nginx"}},
+		{name: "name only", json: `{"name": "nginx"}`, want: ProcessCheck{Name: "nginx", Process: "nginx"}},
+		{name: "process only", json: `{"process": "java"}`, want: ProcessCheck{Name: "java", Process: "java"}},
+		{
+			name:    "regex",
+			json:    `{"name": "kafka", "process": "java", "cmdline": "kafka\\.Kafka"}`,
+			want:    ProcessCheck{Name: "kafka", Process: "java", Cmdline: `kafka\.Kafka`},
+			cmdline: true,
+		},
+		{
+			// Other criteria replace the name as process name
+			name:    "regex without process",
+			json:    `{"name": "worker", "cmdline": "celery .* worker", "user": "app", "min_instances": 4}`,
+			want:    ProcessCheck{Name: "worker", Cmdline: "celery .* worker", User: "app", MinInstances: &four},
+			cmdline: true,
+		},
+		{
+			name: "instance limits",
+			json: `{"name": "backup", "exe": "/opt/backup/bin/*", "min_instances": 0, "max_instances": 1}`,
+			want: ProcessCheck{Name: "backup", Exe: "/opt/backup/bin/*", MinInstances: new(int), MaxInstances: 1},
+		},
+		{name: "missing name", json: `{"exe": "/usr/bin/rsync"}`, wantErr: true},
+		{name: "invalid regex", json: `{"name": "worker", "cmdline": "("}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var got ProcessCheck
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if (got.cmdlineRe != nil) != tt.cmdline {
+			t.Errorf("%s: compiled cmdline = %v", tt.name, got.cmdlineRe)
+		}
+		got.cmdlineRe = nil
+		if got.Name != tt.want.Name || got.Process != tt.want.Process || got.Cmdline != tt.want.Cmdline ||
+			got.Exe != tt.want.Exe || got.User != tt.want.User || got.MaxInstances != tt.want.MaxInstances ||
+			(got.MinInstances == nil) != (tt.want.MinInstances == nil) ||
+			(got.MinInstances != nil && *got.MinInstances != *tt.want.MinInstances) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProcessCheckInstances(t *testing.T) {
+	zero, two := 0, 2
+	tests := []struct {
+		name    string
+		check   ProcessCheck
+		count   int
+		ok      bool
+		tooMany bool
+	}{
+		{"default none", ProcessCheck{}, 0, false, false},
+		{"default one", ProcessCheck{}, 1, true, false},
+		{"default unlimited", ProcessCheck{}, 50, true, false},
+		{"below min", ProcessCheck{MinInstances: &two}, 1, false, false},
+		{"at min", ProcessCheck{MinInstances: &two}, 2, true, false},
+		{"optional", ProcessCheck{MinInstances: &zero, MaxInstances: 1}, 0, true, false},
+		{"at max", ProcessCheck{MinInstances: &zero, MaxInstances: 1}, 1, true, false},
+		{"above max", ProcessCheck{MinInstances: &zero, MaxInstances: 1}, 3, false, true},
+	}
+	for _, tt := range tests {
+		if got := tt.check.instancesOK(tt.count); got != tt.ok {
+			t.Errorf("%s: instancesOK(%d) = %t, want %t", tt.name, tt.count, got, tt.ok)
+		}
+		if got := tt.check.tooManyInstances(tt.count); got != tt.tooMany {
+			t.Errorf("%s: tooManyInstances(%d) = %t, want %t", tt.name, tt.count, got, tt.tooMany)
+		}
+	}
+}
+
+func TestCheckProcessesInstanceViolations(t *testing.T) {
+	zero := 0
+	config := &Config{Processes: []ProcessCheck{
+		{Name: "nginx"},
+		{Name: "backup", MinInstances: &zero, MaxInstances: 1},
+		{Name: "postgres"},
+	}}
+	stats := ProcessStats{Available: true, Checks: []ProcessSample{{Instances: 4}, {Instances: 3}, {Instances: 0}}}
+
+	// Running too often is not the same as not running
+	result := checkProcesses(config, stats)
+	if result.NotRunningCount != 1 || !slices.Equal(result.NotRunning, []string{"postgres"}) {
+		t.Errorf("not running = %d %v, want postgres", result.NotRunningCount, result.NotRunning)
+	}
+	if want := []string{"backup (3 Instanzen, höchstens 1)"}; !slices.Equal(result.InstanceViolations, want) {
+		t.Errorf("instance violations = %q, want %q", result.InstanceViolations, want)
+	}
+}
+
+func TestMatchProcesses(t *testing.T) {
+	self, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := self.Name()
+	if err != nil {
+		t.Skipf("process name not readable: %v", err)
+	}
+	exe, err := self.Exe()
+	if err != nil {
+		t.Skipf("executable not readable: %v", err)
+	}
+	username, err := self.Username()
+	if err != nil {
+		if u, uerr := user.Current(); uerr == nil {
+			username = u.Username
+		}
+	}
+
+	dir := t.TempDir()
+	pidfile := filepath.Join(dir, "self.pid")
+	if err := os.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	otherPidfile := filepath.Join(dir, "other.pid")
+	if err := os.WriteFile(otherPidfile, []byte("1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		name  string
+		json  string
+		match bool
+	}{
+		{"process name", strconv.Quote(name), true},
+		{"other process name", `"no-such-process"`, false},
+		{"regex", `{"name": "test", "cmdline": "-test\\."}`, true},
+		{"regex not matching", `{"name": "test", "cmdline": "^no-such-binary"}`, false},
+		{"name and regex", `{"name": "test", "process": ` + strconv.Quote(name) + `, "cmdline": "^no-such-binary"}`, false},
+		{"executable path", `{"name": "test", "exe": ` + strconv.Quote(exe) + `}`, true},
+		{"executable glob", `{"name": "test", "exe": ` + strconv.Quote(filepath.Join(filepath.Dir(exe), "*")) + `}`, true},
+		{"other executable path", `{"name": "test", "exe": "/no/such/dir/*"}`, false},
+		{"user", `{"name": "test", "exe": ` + strconv.Quote(exe) + `, "user": ` + strconv.Quote(username) + `}`, username != ""},
+		{"other user", `{"name": "test", "exe": ` + strconv.Quote(exe) + `, "user": "no-such-user"}`, false},
+		{"pidfile", `{"name": "test", "pidfile": ` + strconv.Quote(pidfile) + `}`, true},
+		{"pidfile of other process", `{"name": "test", "pidfile": ` + strconv.Quote(otherPidfile) + `}`, false},
+		{"missing pidfile", `{"name": "test", "pidfile": ` + strconv.Quote(filepath.Join(dir, "missing.pid")) + `}`, false},
+	}
+
+	var config []ProcessCheck
+	for _, c := range checks {
+		var check ProcessCheck
+		if err := json.Unmarshal([]byte(c.json), &check); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		config = append(config, check)
+	}
+
+	matches := matchProcesses(config, []*process.Process{self})
+	for i, c := range checks {
+		if got := len(matches[i]) == 1; got != c.match {
+			t.Errorf("%s: match = %t, want %t", c.name, got, c.match)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prometheusExporter serves the most recently collected metrics in the
+// Prometheus text exposition format.
+type prometheusExporter struct {
+	processes []string
+	ports     []string
+	server    *http.Server
+
+	mu     sync.RWMutex
+	latest *SystemMetrics
+}
+
+func init() {
+	registerSink("prometheus", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		var cfg struct {
+			Listen string `json:"listen"`
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Listen == "" {
+			return nil, errors.New("listen fehlt")
+		}
+
+		exporter := newPrometheusExporter(config)
+		if err := exporter.Listen(cfg.Listen); err != nil {
+			return nil, err
+		}
+		return exporter, nil
+	})
+}
+
+func newPrometheusExporter(config *Config) *prometheusExporter {
+	e := &prometheusExporter{}
+	if config != nil {
+		for _, name := range processCheckNames(config.Processes) {
+			if slices.Contains(e.processes, name) {
+				logError("Prozess %s ist mehrfach konfiguriert, Prometheus meldet nur den ersten Eintrag; eindeutigen name vergeben", name)
+				continue
+			}
+			e.processes = append(e.processes, name)
+		}
+		for _, check := range config.Ports {
+			if name := check.String(); !slices.Contains(e.ports, name) {
+				e.ports = append(e.ports, name)
+			}
+		}
+	}
+	return e
+}
+
+// Listen binds the address and serves /metrics in the background. Errors
+// binding the address, e.g. a port already in use, are returned directly.
+func (e *prometheusExporter) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Metrics-Listener auf %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	e.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := e.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logError("Fehler im Metrics-Listener auf %s: %v", addr, err)
+		}
+	}()
+	return nil
+}
+
+func (e *prometheusExporter) Send(metrics SystemMetrics) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.latest = &metrics
+	return nil
+}
+
+func (e *prometheusExporter) Flush() error {
+	return nil
+}
+
+func (e *prometheusExporter) Close() error {
+	if e.server == nil {
+		return nil
+	}
+	return e.server.Close()
+}
+
+func (e *prometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.RLock()
+	latest := e.latest
+	e.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if latest == nil {
+		// Nothing collected yet
+		return
+	}
+
+	w.Write(e.render(*latest))
+}
+
+func (e *prometheusExporter) render(m SystemMetrics) []byte {
+	var buf bytes.Buffer
+	host := promLabels("hostname", m.Hostname)
+
+	writeGauge := func(name, help string, samples ...promSample) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", name)
+		// Duplicate series are invalid and fail the whole scrape, e.g. for
+		// two process checks of the same name; the first sample wins
+		seen := make(map[string]bool, len(samples))
+		for _, sample := range samples {
+			if seen[sample.labels] {
+				continue
+			}
+			seen[sample.labels] = true
+			fmt.Fprintf(&buf, "%s{%s} %s\n", name, sample.labels, strconv.FormatFloat(sample.value, 'g', -1, 64))
+		}
+	}
+
+	writeGauge("host_monitor_cpu_usage_percent", "CPU usage in percent.",
+		promSample{host, m.CPUPercent})
+	if m.CPUModes != nil {
+		writeGauge("host_monitor_cpu_mode_percent", "Share of CPU time per mode in percent.",
+			promCPUModeSamples(m.Hostname, "", *m.CPUModes)...)
+	}
+	if len(m.CPUCores) > 0 {
+		var usage, modes []promSample
+		for _, core := range m.CPUCores {
+			usage = append(usage, promSample{promLabels("hostname", m.Hostname, "core", core.Core), core.Percent})
+			modes = append(modes, promCPUModeSamples(m.Hostname, core.Core, core.CPUModes)...)
+		}
+		writeGauge("host_monitor_cpu_core_usage_percent", "CPU usage per core in percent.", usage...)
+		writeGauge("host_monitor_cpu_core_mode_percent", "Share of CPU time per core and mode in percent.", modes...)
+	}
+	writeGauge("host_monitor_load1", "1 minute load average.",
+		promSample{host, m.LoadAverage1})
+	writeGauge("host_monitor_load5", "5 minute load average.",
+		promSample{host, m.LoadAverage5})
+	writeGauge("host_monitor_load15", "15 minute load average.",
+		promSample{host, m.LoadAverage15})
+	writeGauge("host_monitor_load1_per_cpu", "1 minute load average divided by the number of CPUs.",
+		promSample{host, m.LoadPerCPU1})
+	writeGauge("host_monitor_load5_per_cpu", "5 minute load average divided by the number of CPUs.",
+		promSample{host, m.LoadPerCPU5})
+	writeGauge("host_monitor_load15_per_cpu", "15 minute load average divided by the number of CPUs.",
+		promSample{host, m.LoadPerCPU15})
+	writeGauge("host_monitor_procs_running", "Number of processes in runnable state.",
+		promSample{host, float64(m.ProcsRunning)})
+	writeGauge("host_monitor_procs_blocked", "Number of processes blocked waiting for I/O.",
+		promSample{host, float64(m.ProcsBlocked)})
+	if bootTime, err := time.Parse(time.RFC3339, m.BootTime); err == nil {
+		writeGauge("host_monitor_boot_time_seconds", "Boot time as Unix timestamp.",
+			promSample{host, float64(bootTime.Unix())})
+	}
+	writeGauge("host_monitor_uptime_seconds", "Time since boot in seconds.",
+		promSample{host, float64(m.UptimeSeconds)})
+	writeGauge("host_monitor_memory_usage_percent", "Memory usage in percent.",
+		promSample{host, m.MemoryPercent})
+	writeGauge("host_monitor_memory_used_bytes", "Used memory in bytes.",
+		promSample{host, m.MemoryMB * 1024 * 1024})
+	writeGauge("host_monitor_disk_usage_percent", "Disk usage in percent.",
+		promSample{host, m.DiskPercent})
+	writeGauge("host_monitor_disk_free_bytes", "Free disk space in bytes.",
+		promSample{host, m.DiskFreeGB * 1024 * 1024 * 1024})
+	if len(m.Disks) > 0 {
+		var usage, free, size, inodes, inodesFree []promSample
+		for _, d := range m.Disks {
+			labels := promLabels("hostname", m.Hostname, "mountpoint", d.Path, "device", d.Device, "fstype", d.FSType)
+			usage = append(usage, promSample{labels, d.Percent})
+			free = append(free, promSample{labels, float64(d.FreeBytes)})
+			size = append(size, promSample{labels, float64(d.TotalBytes)})
+			inodes = append(inodes, promSample{labels, d.InodesPercent})
+			inodesFree = append(inodesFree, promSample{labels, float64(d.InodesFree)})
+		}
+		writeGauge("host_monitor_filesystem_usage_percent", "Filesystem usage in percent.", usage...)
+		writeGauge("host_monitor_filesystem_free_bytes", "Free filesystem space in bytes.", free...)
+		writeGauge("host_monitor_filesystem_size_bytes", "Filesystem size in bytes.", size...)
+		writeGauge("host_monitor_filesystem_inodes_usage_percent", "Inode usage in percent.", inodes...)
+		writeGauge("host_monitor_filesystem_inodes_free", "Number of free inodes.", inodesFree...)
+	}
+	if len(m.DiskIO) > 0 {
+		var readBytes, writeBytes, reads, writes, await, util []promSample
+		for _, d := range m.DiskIO {
+			labels := promLabels("hostname", m.Hostname, "device", d.Device)
+			readBytes = append(readBytes, promSample{labels, float64(d.ReadBPS)})
+			writeBytes = append(writeBytes, promSample{labels, float64(d.WriteBPS)})
+			reads = append(reads, promSample{labels, d.ReadIOPS})
+			writes = append(writes, promSample{labels, d.WriteIOPS})
+			await = append(await, promSample{labels, d.AwaitMS})
+			util = append(util, promSample{labels, d.UtilPercent})
+		}
+		writeGauge("host_monitor_disk_read_bytes_per_second", "Bytes read per second per block device.", readBytes...)
+		writeGauge("host_monitor_disk_write_bytes_per_second", "Bytes written per second per block device.", writeBytes...)
+		writeGauge("host_monitor_disk_reads_per_second", "Completed read requests per second per block device.", reads...)
+		writeGauge("host_monitor_disk_writes_per_second", "Completed write requests per second per block device.", writes...)
+		writeGauge("host_monitor_disk_await_milliseconds", "Average time per I/O request in milliseconds.", await...)
+		writeGauge("host_monitor_disk_io_utilization_percent", "Share of time the block device was busy in percent.", util...)
+	}
+	writeGauge("host_monitor_network_receive_bytes_per_second", "Received bytes per second on all monitored interfaces.",
+		promSample{host, float64(m.NetworkRXBPS)})
+	writeGauge("host_monitor_network_transmit_bytes_per_second", "Transmitted bytes per second on all monitored interfaces.",
+		promSample{host, float64(m.NetworkTXBPS)})
+	writeGauge("host_monitor_network_receive_packets_per_second", "Received packets per second on all monitored interfaces.",
+		promSample{host, m.NetworkRXPPS})
+	writeGauge("host_monitor_network_transmit_packets_per_second", "Transmitted packets per second on all monitored interfaces.",
+		promSample{host, m.NetworkTXPPS})
+	writeGauge("host_monitor_network_receive_errors", "Receive errors since the previous sample.",
+		promSample{host, float64(m.NetworkRXErrors)})
+	writeGauge("host_monitor_network_transmit_errors", "Transmit errors since the previous sample.",
+		promSample{host, float64(m.NetworkTXErrors)})
+	writeGauge("host_monitor_network_receive_drops", "Dropped incoming packets since the previous sample.",
+		promSample{host, float64(m.NetworkRXDrops)})
+	writeGauge("host_monitor_network_transmit_drops", "Dropped outgoing packets since the previous sample.",
+		promSample{host, float64(m.NetworkTXDrops)})
+	if len(m.NetworkInterfaces) > 0 {
+		var rxBytes, txBytes, rxPackets, txPackets, rxErrors, txErrors, rxDrops, txDrops []promSample
+		for _, iface := range m.NetworkInterfaces {
+			labels := promLabels("hostname", m.Hostname, "interface", iface.Interface)
+			rxBytes = append(rxBytes, promSample{labels, float64(iface.RXBPS)})
+			txBytes = append(txBytes, promSample{labels, float64(iface.TXBPS)})
+			rxPackets = append(rxPackets, promSample{labels, iface.RXPPS})
+			txPackets = append(txPackets, promSample{labels, iface.TXPPS})
+			rxErrors = append(rxErrors, promSample{labels, float64(iface.RXErrors)})
+			txErrors = append(txErrors, promSample{labels, float64(iface.TXErrors)})
+			rxDrops = append(rxDrops, promSample{labels, float64(iface.RXDrops)})
+			txDrops = append(txDrops, promSample{labels, float64(iface.TXDrops)})
+		}
+		writeGauge("host_monitor_network_interface_receive_bytes_per_second", "Received bytes per second per interface.", rxBytes...)
+		writeGauge("host_monitor_network_interface_transmit_bytes_per_second", "Transmitted bytes per second per interface.", txBytes...)
+		writeGauge("host_monitor_network_interface_receive_packets_per_second", "Received packets per second per interface.", rxPackets...)
+		writeGauge("host_monitor_network_interface_transmit_packets_per_second", "Transmitted packets per second per interface.", txPackets...)
+		writeGauge("host_monitor_network_interface_receive_errors", "Receive errors per interface since the previous sample.", rxErrors...)
+		writeGauge("host_monitor_network_interface_transmit_errors", "Transmit errors per interface since the previous sample.", txErrors...)
+		writeGauge("host_monitor_network_interface_receive_drops", "Dropped incoming packets per interface since the previous sample.", rxDrops...)
+		writeGauge("host_monitor_network_interface_transmit_drops", "Dropped outgoing packets per interface since the previous sample.", txDrops...)
+	}
+	writeGauge("host_monitor_tcp_connections", "Number of TCP connections.",
+		promSample{host, float64(m.TCPConnections)})
+	if len(m.TCPStates) > 0 {
+		var samples []promSample
+		for _, state := range sortedStateNames(m.TCPStates) {
+			samples = append(samples, promSample{promLabels("hostname", m.Hostname, "state", strings.ToLower(state)), float64(m.TCPStates[state])})
+		}
+		writeGauge("host_monitor_tcp_connections_state", "Number of TCP connections per state.", samples...)
+	}
+	writeGauge("host_monitor_tcp_connections_family", "Number of TCP connections per address family.",
+		promSample{promLabels("hostname", m.Hostname, "family", "ipv4"), float64(m.TCPIPv4)},
+		promSample{promLabels("hostname", m.Hostname, "family", "ipv6"), float64(m.TCPIPv6)})
+	writeGauge("host_monitor_udp_sockets", "Number of UDP sockets.",
+		promSample{host, float64(m.UDPSockets)})
+	writeGauge("host_monitor_udp_sockets_family", "Number of UDP sockets per address family.",
+		promSample{promLabels("hostname", m.Hostname, "family", "ipv4"), float64(m.UDPIPv4)},
+		promSample{promLabels("hostname", m.Hostname, "family", "ipv6"), float64(m.UDPIPv6)})
+	if len(m.ListeningPorts) > 0 {
+		var samples []promSample
+		for _, port := range m.ListeningPorts {
+			labels := promLabels("hostname", m.Hostname, "protocol", port.Protocol, "address", port.Address,
+				"port", strconv.FormatUint(uint64(port.Port), 10), "process", port.Process)
+			samples = append(samples, promSample{labels, 1})
+		}
+		writeGauge("host_monitor_listening_port", "Listening port with its owning process, always 1.", samples...)
+	}
+	writeGauge("host_monitor_processes_not_running", "Number of configured processes that are not running.",
+		promSample{host, float64(m.ProcessesNotRunningCount)})
+
+	if len(e.processes) > 0 {
+		notRunning := make(map[string]bool)
+		for _, name := range m.ProcessesNotRunning {
+			notRunning[name] = true
+		}
+
+		var samples []promSample
+		for _, name := range e.processes {
+			var value float64
+			if notRunning[name] {
+				value = 1
+			}
+			samples = append(samples, promSample{promLabels("hostname", m.Hostname, "process", name), value})
+		}
+		writeGauge("host_monitor_process_not_running", "1 if the configured process is not running, 0 otherwise.", samples...)
+	}
+
+	if len(m.Processes) > 0 {
+		var instances, cpu, rss, threads, fds, readBytes, writeBytes, uptime []promSample
+		for _, p := range m.Processes {
+			labels := promLabels("hostname", m.Hostname, "process", p.Name)
+			instances = append(instances, promSample{labels, float64(p.Instances)})
+			cpu = append(cpu, promSample{labels, p.CPUPercent})
+			rss = append(rss, promSample{labels, float64(p.RSSBytes)})
+			threads = append(threads, promSample{labels, float64(p.Threads)})
+			fds = append(fds, promSample{labels, float64(p.OpenFDs)})
+			readBytes = append(readBytes, promSample{labels, float64(p.ReadBPS)})
+			writeBytes = append(writeBytes, promSample{labels, float64(p.WriteBPS)})
+			uptime = append(uptime, promSample{labels, float64(p.UptimeSeconds)})
+		}
+		writeGauge("host_monitor_process_instances", "Number of running instances of the configured process.", instances...)
+		writeGauge("host_monitor_process_cpu_percent", "CPU usage of all instances in percent of one core.", cpu...)
+		writeGauge("host_monitor_process_resident_memory_bytes", "Resident memory of all instances in bytes.", rss...)
+		writeGauge("host_monitor_process_threads", "Number of threads of all instances.", threads...)
+		writeGauge("host_monitor_process_open_fds", "Number of open file descriptors of all instances.", fds...)
+		writeGauge("host_monitor_process_read_bytes_per_second", "Bytes read per second by all instances.", readBytes...)
+		writeGauge("host_monitor_process_write_bytes_per_second", "Bytes written per second by all instances.", writeBytes...)
+		writeGauge("host_monitor_process_uptime_seconds", "Time since the oldest instance was started in seconds.", uptime...)
+	}
+
+	writeGauge("host_monitor_ports_missing", "Number of configured ports that are not listening.",
+		promSample{host, float64(m.PortsMissingCount)})
+
+	if len(e.ports) > 0 {
+		missing := make(map[string]bool)
+		for _, name := range m.PortsMissing {
+			missing[name] = true
+		}
+
+		var samples []promSample
+		for _, name := range e.ports {
+			var value float64
+			if missing[name] {
+				value = 1
+			}
+			samples = append(samples, promSample{promLabels("hostname", m.Hostname, "port", name), value})
+		}
+		writeGauge("host_monitor_port_missing", "1 if the configured port is not listening, 0 otherwise.", samples...)
+	}
+
+	return buf.Bytes()
+}
+
+// promCPUModeSamples returns one sample per CPU mode, labeled with the core
+// unless core is empty.
+func promCPUModeSamples(hostname, core string, modes CPUModes) []promSample {
+	var samples []promSample
+	for _, v := range modes.values() {
+		labels := promLabels("hostname", hostname, "mode", v.mode)
+		if core != "" {
+			labels = promLabels("hostname", hostname, "core", core, "mode", v.mode)
+		}
+		samples = append(samples, promSample{labels, v.value})
+	}
+	return samples
+}
+
+type promSample struct {
+	labels string
+	value  float64
+}
+
+// promLabels formats name/value pairs as a Prometheus label set.
+func promLabels(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+promEscape(pairs[i+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+func promEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusExporterServeHTTP(t *testing.T) {
+	two := 2
+	config := &Config{
+		Processes: []ProcessCheck{{Name: "nginx"}, {Name: "nginx", MinInstances: &two}, {Name: "postgres"}},
+		Ports:     []PortCheck{{Port: 443}, {Port: 443}},
+	}
+	e := newPrometheusExporter(config)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("before the first sample: HTTP %d, %q", rec.Code, rec.Body.String())
+	}
+
+	e.Send(SystemMetrics{
+		Hostname:            "web\"01\\\n",
+		ProcessesNotRunning: []string{"postgres"},
+		Processes:           []ProcessUsage{{Name: "nginx", Instances: 4}, {Name: "nginx", Instances: 1}, {Name: "postgres"}},
+		PortsMissing:        []string{"tcp/443"},
+		ListeningPorts: []ListeningPort{
+			{Protocol: "tcp", Address: "0.0.0.0", Port: 443, Process: "nginx"},
+			{Protocol: "tcp", Address: "::", Port: 443, Process: "nginx"},
+		},
+	})
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	// Every sample follows the HELP and TYPE lines of its metric and every
+	// series occurs once
+	body := rec.Body.String()
+	help := make(map[string]bool)
+	typed := make(map[string]bool)
+	series := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		if rest, ok := strings.CutPrefix(line, "# HELP "); ok {
+			name, text, _ := strings.Cut(rest, " ")
+			if text == "" || help[name] {
+				t.Errorf("HELP line %q", line)
+			}
+			help[name] = true
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, kind, _ := strings.Cut(rest, " ")
+			if !help[name] || kind != "gauge" {
+				t.Errorf("TYPE line %q", line)
+			}
+			typed[name] = true
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			t.Errorf("malformed line %q", line)
+			continue
+		}
+		name, _, _ := strings.Cut(line[:i], "{")
+		if !typed[name] {
+			t.Errorf("sample without TYPE line: %q", line)
+		}
+		if series[line[:i]] {
+			t.Errorf("duplicate series %s", line[:i])
+		}
+		series[line[:i]] = true
+	}
+
+	host := `hostname="web\"01\\\n"`
+	want := []string{
+		`host_monitor_cpu_usage_percent{` + host + `} 0`,
+		`host_monitor_process_not_running{` + host + `,process="nginx"} 0`,
+		`host_monitor_process_not_running{` + host + `,process="postgres"} 1`,
+		`host_monitor_process_instances{` + host + `,process="nginx"} 4`,
+		`host_monitor_port_missing{` + host + `,port="tcp/443"} 1`,
+		`host_monitor_listening_port{` + host + `,protocol="tcp",address="0.0.0.0",port="443",process="nginx"} 1`,
+		`host_monitor_listening_port{` + host + `,protocol="tcp",address="::",port="443",process="nginx"} 1`,
+	}
+	for _, line := range want {
+		if !strings.Contains(body, "\n"+line+"\n") {
+			t.Errorf("missing %s", line)
+		}
+	}
+}
+
+func TestPromLabels(t *testing.T) {
+	tests := []struct {
+		pairs []string
+		want  string
+	}{
+		{[]string{"hostname", "web01"}, `hostname="web01"`},
+		{[]string{"hostname", "web01", "mountpoint", `C:\`}, `hostname="web01",mountpoint="C:\\"`},
+		{[]string{"process", `say "hi"` + "\n"}, `process="say \"hi\"\n"`},
+	}
+	for _, tt := range tests {
+		if got := promLabels(tt.pairs...); got != tt.want {
+			t.Errorf("promLabels(%q) = %s, want %s", tt.pairs, got, tt.want)
+		}
+	}
+}
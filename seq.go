@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	seqRetryMinBackoff = 1 * time.Second
+	seqRetryMaxBackoff = 5 * time.Minute
+
+	// Seq rejects requests above its configured payload limit (10 MB by
+	// default), so batches are flushed well before that
+	seqBatchMaxBytes = 1024 * 1024
+)
+
+type seqOptions struct {
+	URL           string
+	BatchSize     int           // flush after this many events
+	FlushInterval time.Duration // flush at least this often, 0 flushes every event
+	Gzip          bool
+
+	APIKey         string
+	APIKeyFile     string // takes precedence over APIKey
+	CACert         string // PEM bundle added to the system roots
+	ClientCert     string // PEM client certificate for mutual TLS
+	ClientKey      string
+	RequestTimeout time.Duration
+}
+
+// seqSinkConfig is the config.json representation of a Seq sink.
+type seqSinkConfig struct {
+	URL           string       `json:"url"`
+	BatchSize     int          `json:"batch_size"`
+	FlushInterval jsonDuration `json:"flush_interval"`
+	Gzip          bool         `json:"gzip"`
+
+	APIKey     string       `json:"api_key"`
+	APIKeyFile string       `json:"api_key_file"`
+	CACert     string       `json:"ca_cert"`
+	ClientCert string       `json:"client_cert"`
+	ClientKey  string       `json:"client_key"`
+	Timeout    jsonDuration `json:"timeout"`
+
+	spoolConfig
+}
+
+func init() {
+	registerSink("seq", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := seqSinkConfig{
+			BatchSize: 100,
+			Timeout:   jsonDuration(30 * time.Second),
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+		if cfg.URL == "" {
+			return nil, errors.New("url fehlt")
+		}
+
+		sp, err := cfg.openSpool(name, 100)
+		if err != nil {
+			return nil, err
+		}
+
+		return newSeqSender(seqOptions{
+			URL:            cfg.URL,
+			BatchSize:      cfg.BatchSize,
+			FlushInterval:  time.Duration(cfg.FlushInterval),
+			Gzip:           cfg.Gzip,
+			APIKey:         cfg.APIKey,
+			APIKeyFile:     cfg.APIKeyFile,
+			CACert:         cfg.CACert,
+			ClientCert:     cfg.ClientCert,
+			ClientKey:      cfg.ClientKey,
+			RequestTimeout: time.Duration(cfg.Timeout),
+		}, sp)
+	})
+}
+
+// newSeqHTTPClient builds the HTTP client used for all Seq requests from the
+// TLS and timeout options.
+func newSeqHTTPClient(opts seqOptions) (*http.Client, error) {
+	return newHTTPClient(opts.CACert, opts.ClientCert, opts.ClientKey, opts.RequestTimeout)
+}
+
+// seqSender delivers events to Seq. Events are collected into batches which
+// are flushed as one newline-delimited request once the batch is full or the
+// flush interval has elapsed. Batches that cannot be delivered are buffered
+// in the spool and replayed in order with exponential backoff.
+type seqSender struct {
+	opts    seqOptions
+	client  *http.Client
+	apiKey  string
+	batches *batcher
+}
+
+func newSeqSender(opts seqOptions, sp *spool) (*seqSender, error) {
+	client, err := newSeqHTTPClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := opts.APIKey
+	if opts.APIKeyFile != "" {
+		data, err := os.ReadFile(opts.APIKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("API-Key-Datei lesen: %w", err)
+		}
+		apiKey = strings.TrimSpace(string(data))
+	}
+
+	s := &seqSender{
+		opts:   opts,
+		client: client,
+		apiKey: apiKey,
+	}
+	queue := newDeliveryQueue("Seq", s.sendBatch, sp, retryPolicy{
+		MinBackoff: seqRetryMinBackoff,
+		MaxBackoff: seqRetryMaxBackoff,
+	})
+	s.batches = newBatcher(queue, opts.BatchSize, seqBatchMaxBytes, opts.FlushInterval)
+
+	return s, nil
+}
+
+func (s *seqSender) Send(metrics SystemMetrics) error {
+	jsonData, err := json.Marshal(metrics)
+	if err != nil {
+		return fmt.Errorf("JSON-Encoding: %w", err)
+	}
+	return s.batches.Add(jsonData)
+}
+
+// Flush sends all collected events as one request.
+func (s *seqSender) Flush() error {
+	return s.batches.Flush()
+}
+
+func (s *seqSender) Close() error {
+	return s.batches.Close()
+}
+
+// sendBatch sends a batch of events. Seq rejects the whole request if a
+// single event is invalid, so a rejected batch is split in halves until the
+// invalid events are found. These are logged and dropped, all others are
+// delivered.
+func (s *seqSender) sendBatch(records [][]byte) error {
+	err := s.sendToSeq(bytes.Join(records, []byte("\n")))
+
+	var statusErr *httpStatusError
+	if err == nil || !errors.As(err, &statusErr) || !statusErr.permanent() {
+		return err
+	}
+	if len(records) == 1 {
+		logError("Event von Seq abgelehnt und verworfen: %v: %s", err, records[0])
+		return nil
+	}
+
+	half := len(records) / 2
+	if err := s.sendBatch(records[:half]); err != nil {
+		return err
+	}
+	return s.sendBatch(records[half:])
+}
+
+// sendToSeq posts newline-delimited CLEF events to the Seq ingestion endpoint.
+func (s *seqSender) sendToSeq(body []byte) error {
+	if s.opts.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.opts.URL+"/ingest/clef", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.serilog.clef")
+	if s.opts.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if s.apiKey != "" {
+		req.Header.Set("X-Seq-ApiKey", s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkHTTPResponse(resp)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSeqSenderSplitsRejectedBatch(t *testing.T) {
+	var mu sync.Mutex
+	var accepted []string
+	var contentType string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		contentType = r.Header.Get("Content-Type")
+		// Like Seq, reject the whole request if one event is invalid
+		if strings.Contains(string(body), "bad") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		accepted = append(accepted, strings.Split(string(body), "\n")...)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	sender := &seqSender{opts: seqOptions{URL: server.URL}, client: server.Client()}
+	records := [][]byte{[]byte("1"), []byte("2"), []byte("bad"), []byte("4"), []byte("5")}
+	if err := sender.sendBatch(records); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(accepted, ","); got != "1,2,4,5" {
+		t.Errorf("accepted %s, want 1,2,4,5", got)
+	}
+	if contentType != "application/vnd.serilog.clef" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+}
+
+func TestSeqSenderReturnsTemporaryErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sender := &seqSender{opts: seqOptions{URL: server.URL}, client: server.Client()}
+	if err := sender.sendBatch([][]byte{[]byte("1"), []byte("2")}); err == nil {
+		t.Error("no error for unavailable server")
+	}
+}
+
+func TestNewSeqSenderAPIKey(t *testing.T) {
+	var mu sync.Mutex
+	var apiKeys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		apiKeys = append(apiKeys, r.Header.Get("X-Seq-ApiKey"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "seq.key")
+	if err := os.WriteFile(keyFile, []byte("  file-key\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		apiKeyFile string
+		want       string
+	}{
+		{"without key", "", "", ""},
+		{"api_key", "flag-key", "", "flag-key"},
+		// The file is trimmed and takes precedence
+		{"api_key_file", "flag-key", keyFile, "file-key"},
+	}
+	for _, tt := range tests {
+		sender, err := newSeqSender(seqOptions{URL: server.URL, APIKey: tt.apiKey, APIKeyFile: tt.apiKeyFile}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := sender.Send(SystemMetrics{Hostname: "web01"}); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		sender.Close()
+
+		mu.Lock()
+		got := apiKeys[len(apiKeys)-1]
+		mu.Unlock()
+		if got != tt.want {
+			t.Errorf("%s: X-Seq-ApiKey = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	_, err := newSeqSender(seqOptions{URL: server.URL, APIKeyFile: filepath.Join(t.TempDir(), "missing")}, nil)
+	if err == nil || !strings.Contains(err.Error(), "API-Key-Datei lesen") {
+		t.Errorf("missing api_key_file: err = %v", err)
+	}
+}
+
+func TestNewSeqSenderMutualTLS(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	received := make(chan string, 1)
+	server := newMutualTLSServer(t, ca, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	sender, err := newSeqSender(seqOptions{URL: server.URL, CACert: ca.certPath, ClientCert: clientCert, ClientKey: clientKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	if err := sender.Send(SystemMetrics{Hostname: "web01"}); err != nil {
+		t.Fatal(err)
+	}
+	if body := <-received; !strings.Contains(body, `"Hostname":"web01"`) {
+		t.Errorf("received %s", body)
+	}
+
+	// A server certificate of an unknown CA is rejected
+	unknownCA := newTestCA(t, "unknown")
+	sender, err = newSeqSender(seqOptions{URL: server.URL, CACert: unknownCA.certPath, ClientCert: clientCert, ClientKey: clientKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	if err := sender.Send(SystemMetrics{Hostname: "web01"}); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("unknown CA: err = %v", err)
+	}
+
+	if _, err := newSeqSender(seqOptions{URL: server.URL, ClientCert: clientCert}, nil); err == nil {
+		t.Error("no error for client certificate without key")
+	}
+}
@@ -12,12 +12,12 @@ func isWindowsService() bool {
 	return false
 }
 
-func runAsWindowsService(debug bool, seqURL string, interval time.Duration) {
+func runAsWindowsService(sink Sink, config *Config, interval time.Duration) {
 	fmt.Fprintf(os.Stderr, "Windows Service Funktionalität ist nur unter Windows verfügbar\n")
 	os.Exit(1)
 }
 
-func installWindowsService(serviceName, seqURL string, interval time.Duration, debug bool) {
+func installWindowsService(serviceName, seqURL string, interval time.Duration, debug bool, extraArgs []string) {
 	fmt.Fprintf(os.Stderr, "Windows Service Installation ist nur unter Windows verfügbar\n")
 	os.Exit(1)
 }
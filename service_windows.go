@@ -13,8 +13,8 @@ import (
 )
 
 type windowsService struct {
-	debug    bool
-	seqURL   string
+	sink     Sink
+	config   *Config
 	interval time.Duration
 }
 
@@ -23,7 +23,8 @@ func (ws *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, s c
 
 	// Start monitoring in separate goroutine
 	stopCh := make(chan struct{})
-	go ws.runMonitoring(stopCh)
+	doneCh := make(chan struct{})
+	go runMonitoring(ws.sink, ws.config, ws.interval, stopCh, doneCh)
 
 	s <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
 
@@ -34,6 +35,9 @@ func (ws *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, s c
 		case svc.Stop, svc.Shutdown:
 			s <- svc.Status{State: svc.StopPending}
 			close(stopCh)
+			// The sinks are closed once Execute returns, a sample still
+			// being collected must be handed over before
+			<-doneCh
 			return false, 0
 		default:
 			continue
@@ -43,46 +47,10 @@ func (ws *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, s c
 	return false, 0
 }
 
-func (ws *windowsService) runMonitoring(stopCh <-chan struct{}) {
-	hostname := getHostname()
-	config := loadConfig()
-
-	prevNetStats := getNetworkStats()
-	prevCPUStats := getCPUStats()
-	prevTime := time.Now()
-
-	ticker := time.NewTicker(ws.interval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-stopCh:
-			return
-		case <-ticker.C:
-			currNetStats := getNetworkStats()
-			currCPUStats := getCPUStats()
-			currTime := time.Now()
-
-			timeDiff := currTime.Sub(prevTime).Seconds()
-			metrics := collectMetrics(hostname, prevNetStats, currNetStats, prevCPUStats, currCPUStats, timeDiff, config)
-
-			if ws.debug {
-				printDebugMetrics(metrics)
-			} else {
-				sendToSeq(ws.seqURL, metrics)
-			}
-
-			prevNetStats = currNetStats
-			prevCPUStats = currCPUStats
-			prevTime = currTime
-		}
-	}
-}
-
-func runAsWindowsService(debug bool, seqURL string, interval time.Duration) {
+func runAsWindowsService(sink Sink, config *Config, interval time.Duration) {
 	service := &windowsService{
-		debug:    debug,
-		seqURL:   seqURL,
+		sink:     sink,
+		config:   config,
 		interval: interval,
 	}
 
@@ -100,7 +68,7 @@ func isWindowsService() bool {
 	return !isIntSess
 }
 
-func installWindowsService(serviceName, seqURL string, interval time.Duration, debug bool) {
+func installWindowsService(serviceName, seqURL string, interval time.Duration, debug bool, extraArgs []string) {
 	exePath, err := os.Executable()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Fehler beim Ermitteln des Programmpfads: %v\n", err)
@@ -127,6 +95,7 @@ func installWindowsService(serviceName, seqURL string, interval time.Duration, d
 	if debug {
 		serviceArgs = append(serviceArgs, "--debug")
 	}
+	serviceArgs = append(serviceArgs, extraArgs...)
 
 	s, err = m.CreateService(serviceName, exePath, mgr.Config{
 		DisplayName: "Host Monitor Service",
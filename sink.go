@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultSinkQueueSize = 100
+
+// Sink is an output destination for collected metrics.
+type Sink interface {
+	Send(metrics SystemMetrics) error
+	Flush() error
+	Close() error
+}
+
+// sinkFactory creates a sink from its entry in config.json. The raw message
+// contains the complete entry including the common fields of SinkConfig.
+type sinkFactory func(name string, raw json.RawMessage, config *Config) (Sink, error)
+
+var sinkFactories = map[string]sinkFactory{}
+
+// registerSink makes a sink type available for config.json. It is called
+// from the init functions of the individual sink implementations.
+func registerSink(kind string, factory sinkFactory) {
+	sinkFactories[kind] = factory
+}
+
+// SinkConfig is an entry of the "sinks" list in config.json. Besides the
+// common fields every entry carries the options of its sink type.
+type SinkConfig struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	QueueSize int    `json:"queue_size"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+func (c *SinkConfig) UnmarshalJSON(data []byte) error {
+	type common SinkConfig
+	var cfg common
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+
+	*c = SinkConfig(cfg)
+	c.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// fanoutSink hands every sample to all of its sinks. Each sink runs
+// decoupled behind its own queue.
+type fanoutSink struct {
+	names map[string]bool
+	sinks []Sink
+}
+
+func newFanoutSink() *fanoutSink {
+	return &fanoutSink{names: make(map[string]bool)}
+}
+
+// Add registers a sink under a unique name.
+func (f *fanoutSink) Add(name string, sink Sink, queueSize int) error {
+	if f.names[name] {
+		return fmt.Errorf("Ausgabe %q ist mehrfach konfiguriert", name)
+	}
+
+	f.names[name] = true
+	f.sinks = append(f.sinks, newAsyncSink(name, sink, queueSize))
+	return nil
+}
+
+// AddFromConfig creates and registers all sinks configured in config.json.
+func (f *fanoutSink) AddFromConfig(config *Config) error {
+	if config == nil {
+		return nil
+	}
+
+	for i, cfg := range config.Sinks {
+		factory, ok := sinkFactories[cfg.Type]
+		if !ok {
+			return fmt.Errorf("unbekannter Ausgabe-Typ %q", cfg.Type)
+		}
+
+		name := cfg.Name
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", cfg.Type, i+1)
+		}
+
+		sink, err := factory(name, cfg.Raw, config)
+		if err != nil {
+			return fmt.Errorf("Ausgabe %s: %w", name, err)
+		}
+		if err := f.Add(name, sink, cfg.QueueSize); err != nil {
+			sink.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *fanoutSink) Len() int {
+	return len(f.sinks)
+}
+
+func (f *fanoutSink) Send(metrics SystemMetrics) error {
+	var errs []error
+	for _, sink := range f.sinks {
+		errs = append(errs, sink.Send(metrics))
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fanoutSink) Flush() error {
+	var errs []error
+	for _, sink := range f.sinks {
+		errs = append(errs, sink.Flush())
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fanoutSink) Close() error {
+	var errs []error
+	for _, sink := range f.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// asyncSink decouples a sink from the collection loop with a bounded queue
+// and its own goroutine, so a slow or unreachable destination cannot delay
+// the others. Errors of the wrapped sink are logged with the sink name.
+type asyncSink struct {
+	name string
+	sink Sink
+
+	queue chan asyncSinkItem
+	done  chan struct{}
+
+	// closed guards the queue against sends after Close
+	mu     sync.Mutex
+	closed bool
+}
+
+type asyncSinkItem struct {
+	metrics SystemMetrics
+	flush   bool
+}
+
+func newAsyncSink(name string, sink Sink, queueSize int) *asyncSink {
+	if queueSize <= 0 {
+		queueSize = defaultSinkQueueSize
+	}
+
+	a := &asyncSink{
+		name:  name,
+		sink:  sink,
+		queue: make(chan asyncSinkItem, queueSize),
+		done:  make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *asyncSink) Send(metrics SystemMetrics) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return fmt.Errorf("Ausgabe %s: bereits geschlossen, Event verworfen", a.name)
+	}
+	select {
+	case a.queue <- asyncSinkItem{metrics: metrics}:
+		return nil
+	default:
+		return fmt.Errorf("Ausgabe %s: Warteschlange voll, Event verworfen", a.name)
+	}
+}
+
+func (a *asyncSink) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return fmt.Errorf("Ausgabe %s: bereits geschlossen", a.name)
+	}
+	select {
+	case a.queue <- asyncSinkItem{flush: true}:
+	default:
+		// A full queue is processed anyway
+	}
+	return nil
+}
+
+// Close waits until all queued samples are handed to the sink and closes it.
+func (a *asyncSink) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+	if err := a.sink.Close(); err != nil {
+		return fmt.Errorf("Ausgabe %s: %w", a.name, err)
+	}
+	return nil
+}
+
+func (a *asyncSink) run() {
+	defer close(a.done)
+
+	for item := range a.queue {
+		var err error
+		if item.flush {
+			err = a.sink.Flush()
+		} else {
+			err = a.sink.Send(item.metrics)
+		}
+		if err != nil {
+			logError("Fehler in Ausgabe %s: %v", a.name, err)
+		}
+	}
+}
+
+// metricsTime returns the collection time of a sample.
+func metricsTime(metrics SystemMetrics) time.Time {
+	t, err := time.Parse(time.RFC3339, metrics.Timestamp)
+	if err != nil {
+		return time.Now()
+	}
+	return t
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// countingSink counts the samples it receives.
+type countingSink struct {
+	mu     sync.Mutex
+	sent   int
+	closed bool
+}
+
+func (s *countingSink) Send(metrics SystemMetrics) error {
+	s.mu.Lock()
+	s.sent++
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *countingSink) Flush() error {
+	return nil
+}
+
+func (s *countingSink) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return nil
+}
+
+func TestAsyncSinkCloseDeliversQueuedSamples(t *testing.T) {
+	inner := &countingSink{}
+	sink := newAsyncSink("test", inner, 10)
+
+	for i := 0; i < 5; i++ {
+		if err := sink.Send(SystemMetrics{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if inner.sent != 5 || !inner.closed {
+		t.Errorf("sent %d, closed %t, want 5 and true", inner.sent, inner.closed)
+	}
+}
+
+func TestAsyncSinkSendAfterClose(t *testing.T) {
+	sink := newAsyncSink("test", &countingSink{}, 10)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Send(SystemMetrics{}); err == nil {
+		t.Error("Send after Close returned no error")
+	}
+	if err := sink.Flush(); err == nil {
+		t.Error("Flush after Close returned no error")
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestAsyncSinkConcurrentSendAndClose(t *testing.T) {
+	sink := newAsyncSink("test", &countingSink{}, 10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				sink.Send(SystemMetrics{})
+				sink.Flush()
+			}
+		}()
+	}
+	sink.Close()
+	wg.Wait()
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"syscall"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// socketsConfig controls the optional parts of the socket statistics.
+type socketsConfig struct {
+	ListeningPorts bool `json:"listening_ports"` // report listening ports with their process
+}
+
+// SocketStats holds the socket counts of one sample.
+type SocketStats struct {
+	TCP, TCPIPv4, TCPIPv6 int
+	TCPStates             map[string]int
+	UDP, UDPIPv4, UDPIPv6 int
+	Listening             []ListeningPort
+}
+
+// ListeningPort is a TCP socket in LISTEN state or an unconnected UDP socket.
+type ListeningPort struct {
+	Protocol string `json:"Protocol"` // "tcp" or "udp"
+	Address  string `json:"Address"`
+	Port     uint32 `json:"Port"`
+	PID      int32  `json:"PID,omitempty"`
+	Process  string `json:"Process,omitempty"`
+
+	// All processes sharing the socket, e.g. nginx master and workers or
+	// systemd and the service of an activated socket. PID and Process are
+	// the first of them.
+	pids      []int32
+	processes []string
+}
+
+// getSocketStats counts TCP connections per state and address family, UDP
+// sockets and collects the listening ports. Process names are only resolved
+// when withProcesses is set, since that requires a lookup per PID.
+func getSocketStats(withProcesses bool) SocketStats {
+	connections, err := net.Connections("inet")
+	if err != nil {
+		logError("Fehler beim Abrufen der Verbindungen: %v", err)
+		return SocketStats{TCPStates: make(map[string]int)}
+	}
+
+	stats := countSockets(connections)
+	if withProcesses {
+		names := make(map[int32]string)
+		resolveListeningProcesses(stats.Listening, func(pid int32) string {
+			name, found := names[pid]
+			if !found {
+				if p, err := process.NewProcess(pid); err == nil {
+					name, _ = p.Name()
+				}
+				names[pid] = name
+			}
+			return name
+		})
+	}
+	return stats
+}
+
+// countSockets evaluates the sockets returned by net.Connections.
+func countSockets(connections []net.ConnectionStat) SocketStats {
+	stats := SocketStats{TCPStates: make(map[string]int)}
+
+	type socketKey struct {
+		protocol, address string
+		port              uint32
+	}
+	index := make(map[socketKey]int)
+	for _, conn := range connections {
+		var protocol string
+		switch conn.Type {
+		case syscall.SOCK_STREAM:
+			protocol = "tcp"
+			stats.TCP++
+			if conn.Family == syscall.AF_INET6 {
+				stats.TCPIPv6++
+			} else {
+				stats.TCPIPv4++
+			}
+			stats.TCPStates[normalizeTCPState(conn.Status)]++
+			if conn.Status != "LISTEN" {
+				continue
+			}
+		case syscall.SOCK_DGRAM:
+			protocol = "udp"
+			stats.UDP++
+			if conn.Family == syscall.AF_INET6 {
+				stats.UDPIPv6++
+			} else {
+				stats.UDPIPv4++
+			}
+			if conn.Raddr.Port != 0 || conn.Laddr.Port == 0 {
+				continue
+			}
+		default:
+			continue
+		}
+
+		// Sockets shared by several processes are reported once with all
+		// of their processes
+		key := socketKey{protocol, conn.Laddr.IP, conn.Laddr.Port}
+		i, found := index[key]
+		if !found {
+			i = len(stats.Listening)
+			index[key] = i
+			stats.Listening = append(stats.Listening, ListeningPort{
+				Protocol: protocol,
+				Address:  conn.Laddr.IP,
+				Port:     conn.Laddr.Port,
+			})
+		}
+		if conn.Pid != 0 && !slices.Contains(stats.Listening[i].pids, conn.Pid) {
+			stats.Listening[i].pids = append(stats.Listening[i].pids, conn.Pid)
+		}
+	}
+
+	for i := range stats.Listening {
+		pids := stats.Listening[i].pids
+		slices.Sort(pids)
+		if len(pids) > 0 {
+			stats.Listening[i].PID = pids[0]
+		}
+	}
+	sort.Slice(stats.Listening, func(i, j int) bool {
+		a, b := stats.Listening[i], stats.Listening[j]
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Address < b.Address
+	})
+
+	return stats
+}
+
+// resolveListeningProcesses sets the names of the processes owning each
+// listening socket, looked up by processName.
+func resolveListeningProcesses(ports []ListeningPort, processName func(pid int32) string) {
+	for i := range ports {
+		ports[i].processes = nil
+		for _, pid := range ports[i].pids {
+			name := processName(pid)
+			if name != "" && !slices.Contains(ports[i].processes, name) {
+				ports[i].processes = append(ports[i].processes, name)
+			}
+		}
+		if ports[i].PID != 0 {
+			ports[i].Process = processName(ports[i].PID)
+		}
+	}
+}
+
+// sortedStateNames returns the TCP states in a stable order.
+func sortedStateNames(states map[string]int) []string {
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tcpStateNames maps the TCP state names reported on Windows and macOS to
+// the Linux names.
+var tcpStateNames = map[string]string{
+	"ESTABLISHED":  "ESTABLISHED",
+	"SYN_SENT":     "SYN_SENT",
+	"SYN_RECV":     "SYN_RECV",
+	"SYN_RECEIVED": "SYN_RECV",
+	"SYN_RCVD":     "SYN_RECV",
+	"FIN_WAIT1":    "FIN_WAIT1",
+	"FIN_WAIT_1":   "FIN_WAIT1",
+	"FIN_WAIT2":    "FIN_WAIT2",
+	"FIN_WAIT_2":   "FIN_WAIT2",
+	"TIME_WAIT":    "TIME_WAIT",
+	"CLOSE":        "CLOSE",
+	"CLOSED":       "CLOSE",
+	"DELETE":       "CLOSE", // Windows DELETE_TCB, the connection is being removed
+	"CLOSE_WAIT":   "CLOSE_WAIT",
+	"LAST_ACK":     "LAST_ACK",
+	"LISTEN":       "LISTEN",
+	"CLOSING":      "CLOSING",
+}
+
+// normalizeTCPState maps the state names of the different platforms to the
+// Linux names. States without a mapping, e.g. states the kernel added after
+// gopsutil's table, are counted as UNKNOWN.
+func normalizeTCPState(status string) string {
+	if name, ok := tcpStateNames[status]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	splunkRetryMinBackoff = 1 * time.Second
+	splunkRetryMaxBackoff = 5 * time.Minute
+
+	// Splunk's default max_content_length is 800 MB, but smaller requests
+	// keep retries cheap
+	splunkBatchMaxBytes = 1024 * 1024
+
+	splunkAckPollInterval = 1 * time.Second
+)
+
+// splunkSinkConfig is the config.json representation of a Splunk HTTP Event
+// Collector sink.
+type splunkSinkConfig struct {
+	URL        string `json:"url"`
+	Token      string `json:"token"`
+	Mode       string `json:"mode"` // "event" or "metrics"
+	Index      string `json:"index"`
+	Source     string `json:"source"`
+	Sourcetype string `json:"sourcetype"`
+
+	// Indexer acknowledgement
+	UseAck     bool         `json:"use_ack"`
+	Channel    string       `json:"channel"` // random GUID if empty
+	AckTimeout jsonDuration `json:"ack_timeout"`
+
+	CACert     string       `json:"ca_cert"`
+	ClientCert string       `json:"client_cert"`
+	ClientKey  string       `json:"client_key"`
+	Timeout    jsonDuration `json:"timeout"`
+
+	BatchSize     int          `json:"batch_size"`
+	FlushInterval jsonDuration `json:"flush_interval"`
+
+	spoolConfig
+}
+
+// splunkSink sends samples to the HTTP Event Collector, either as JSON events
+// or in the multiple-metric format. With indexer acknowledgement enabled a
+// batch only counts as delivered once Splunk confirms it was indexed.
+type splunkSink struct {
+	cfg     splunkSinkConfig
+	baseURL string
+	client  *http.Client
+	batches *batcher
+
+	ackPollInterval time.Duration
+	done            chan struct{} // closed on shutdown to stop waiting for acks
+}
+
+func init() {
+	registerSink("splunk", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := splunkSinkConfig{
+			Mode:       "event",
+			Source:     "host-monitor",
+			AckTimeout: jsonDuration(60 * time.Second),
+			Timeout:    jsonDuration(30 * time.Second),
+			BatchSize:  100,
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+
+		// Like for webhooks the spool is opt-in
+		if cfg.SpoolMaxSize == nil {
+			cfg.SpoolMaxSize = new(int)
+		}
+		sp, err := cfg.openSpool(name, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		return newSplunkSink(name, cfg, sp)
+	})
+}
+
+func newSplunkSink(name string, cfg splunkSinkConfig, sp *spool) (*splunkSink, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("url fehlt")
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("token fehlt")
+	}
+	switch cfg.Mode {
+	case "event":
+		if cfg.Sourcetype == "" {
+			cfg.Sourcetype = "_json"
+		}
+	case "metrics":
+	default:
+		return nil, fmt.Errorf("unbekannter Modus %q", cfg.Mode)
+	}
+	if cfg.UseAck && cfg.Channel == "" {
+		cfg.Channel = splunkNewChannel()
+	}
+
+	client, err := newHTTPClient(cfg.CACert, cfg.ClientCert, cfg.ClientKey, time.Duration(cfg.Timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &splunkSink{
+		cfg:             cfg,
+		baseURL:         strings.TrimSuffix(cfg.URL, "/"),
+		client:          client,
+		ackPollInterval: splunkAckPollInterval,
+		done:            make(chan struct{}),
+	}
+	queue := newDeliveryQueue(name, s.sendEvents, sp, retryPolicy{
+		MinBackoff: splunkRetryMinBackoff,
+		MaxBackoff: splunkRetryMaxBackoff,
+	})
+	s.batches = newBatcher(queue, cfg.BatchSize, splunkBatchMaxBytes, time.Duration(cfg.FlushInterval))
+
+	return s, nil
+}
+
+func (s *splunkSink) Send(metrics SystemMetrics) error {
+	if s.cfg.Mode != "metrics" {
+		return s.add(s.newEvent(metrics, metrics))
+	}
+
+	for _, fields := range splunkMetricFields(metrics) {
+		event := s.newEvent(metrics, "metric")
+		event["fields"] = fields
+		if err := s.add(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *splunkSink) newEvent(metrics SystemMetrics, body any) map[string]any {
+	event := map[string]any{
+		"time":   metricsTime(metrics).Unix(),
+		"host":   metrics.Hostname,
+		"source": s.cfg.Source,
+		"event":  body,
+	}
+	if s.cfg.Sourcetype != "" {
+		event["sourcetype"] = s.cfg.Sourcetype
+	}
+	if s.cfg.Index != "" {
+		event["index"] = s.cfg.Index
+	}
+	return event
+}
+
+func (s *splunkSink) add(event map[string]any) error {
+	record, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("JSON-Encoding: %w", err)
+	}
+	return s.batches.Add(record)
+}
+
+func (s *splunkSink) Flush() error {
+	return s.batches.Flush()
+}
+
+func (s *splunkSink) Close() error {
+	// Acks of the last batch are not waited for; it is spooled like any
+	// other unconfirmed batch
+	close(s.done)
+	return s.batches.Close()
+}
+
+// sendEvents posts a batch of events, which HEC accepts as concatenated JSON
+// objects, and waits for the indexer acknowledgement if enabled.
+func (s *splunkSink) sendEvents(records [][]byte) error {
+	data, err := s.post("/services/collector/event", bytes.Join(records, []byte("\n")))
+	if err != nil {
+		return err
+	}
+	if !s.cfg.UseAck {
+		return nil
+	}
+
+	var result struct {
+		AckID *int64 `json:"ackId"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil || result.AckID == nil {
+		return errors.New("keine ackId in der Antwort, ist die Indexer-Bestätigung für den Token aktiviert?")
+	}
+	return s.awaitAck(*result.AckID)
+}
+
+// awaitAck polls the ack endpoint until the batch is indexed. A batch that is
+// not confirmed in time or before shutdown is sent again. HEC has no way to
+// deduplicate events, so a batch that was indexed but confirmed late is
+// stored twice.
+func (s *splunkSink) awaitAck(id int64) error {
+	body, _ := json.Marshal(map[string][]int64{"acks": {id}})
+	deadline := time.Now().Add(time.Duration(s.cfg.AckTimeout))
+
+	for {
+		data, err := s.post("/services/collector/ack", body)
+		if err != nil {
+			return err
+		}
+
+		var result struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("Antwort des Ack-Endpunkts: %w", err)
+		}
+		if result.Acks[strconv.FormatInt(id, 10)] {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Indexierung von ackId %d nicht innerhalb von %s bestätigt", id, time.Duration(s.cfg.AckTimeout))
+		}
+		select {
+		case <-time.After(s.ackPollInterval):
+		case <-s.done:
+			return fmt.Errorf("Indexierung von ackId %d vor dem Beenden nicht bestätigt", id)
+		}
+	}
+}
+
+func (s *splunkSink) post(path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, s.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+s.cfg.Token)
+	if s.cfg.Channel != "" {
+		req.Header.Set("X-Splunk-Request-Channel", s.cfg.Channel)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, checkHTTPResponse(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// splunkMetricFields converts a sample into the multiple-metric format,
+// where every measurement is a "metric_name:<name>" field. Values of a core,
+// device, interface or process are sent as an event of their own with the
+// instance as dimension, e.g. device="sda", and replace the host-wide value
+// of the same name.
+func splunkMetricFields(m SystemMetrics) []map[string]any {
+	host := map[string]any{"application": m.Application}
+
+	events := []map[string]any{host}
+	var instance map[string]any
+	for _, f := range withoutTotals(flattenMetrics(m)) {
+		if f.dim == "" {
+			host["metric_name:"+f.name] = f.value
+			continue
+		}
+		if instance == nil || instance[f.dim] != f.instance {
+			instance = map[string]any{"application": m.Application, f.dim: f.instance}
+			events = append(events, instance)
+		}
+		instance["metric_name:"+f.name] = f.value
+	}
+	return events
+}
+
+// splunkNewChannel returns a random UUID as used for request channels.
+func splunkNewChannel() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
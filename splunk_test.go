@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSplunkMetricFields(t *testing.T) {
+	m := SystemMetrics{
+		Application: "Monitor",
+		CPUPercent:  12.5,
+		CPUModes:    &CPUModes{User: 10},
+		CPUCores: []CPUCoreUsage{
+			{Core: "cpu0", Percent: 50},
+			{Core: "cpu1", Percent: 25},
+		},
+	}
+
+	events := splunkMetricFields(m)
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want the host and one per core", len(events))
+	}
+	// The per-core events replace the host-wide CPU values of the same name
+	if _, ok := events[0]["metric_name:cpu.percent"]; ok {
+		t.Errorf("host event contains the CPU total: %v", events[0])
+	}
+	if events[0]["metric_name:memory.percent"] != 0.0 {
+		t.Errorf("host event = %v", events[0])
+	}
+	for i, core := range []string{"cpu0", "cpu1"} {
+		event := events[i+1]
+		if event["core"] != core || event["metric_name:cpu.percent"] != m.CPUCores[i].Percent || event["application"] != "Monitor" {
+			t.Errorf("event for %s = %v", core, event)
+		}
+		if _, ok := event["metric_name:tcp.connections"]; ok {
+			t.Errorf("event for %s contains host values", core)
+		}
+	}
+
+	m.CPUCores = nil
+	if host := splunkMetricFields(m)[0]; host["metric_name:cpu.percent"] != 12.5 || host["metric_name:cpu.user_percent"] != 10.0 {
+		t.Errorf("host event without cores = %v", host)
+	}
+}
+
+// hecServer is an HTTP Event Collector stand-in that hands out ackIds and
+// confirms them once acked is set.
+type hecServer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	status     int
+	acked      bool
+	events     []string
+	ackPolls   int
+	authHeader string
+	channel    string
+}
+
+func newHECServer(t *testing.T) *hecServer {
+	s := &hecServer{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.authHeader = r.Header.Get("Authorization")
+		s.channel = r.Header.Get("X-Splunk-Request-Channel")
+		switch r.URL.Path {
+		case "/services/collector/event":
+			if s.status != http.StatusOK {
+				w.WriteHeader(s.status)
+				w.Write([]byte(`{"text":"Invalid token","code":4}`))
+				return
+			}
+			s.events = append(s.events, string(body))
+			json.NewEncoder(w).Encode(map[string]any{"text": "Success", "code": 0, "ackId": len(s.events) - 1})
+		case "/services/collector/ack":
+			s.ackPolls++
+			var req struct {
+				Acks []int64 `json:"acks"`
+			}
+			json.Unmarshal(body, &req)
+			acks := make(map[string]bool)
+			for _, id := range req.Acks {
+				acks[strconv.FormatInt(id, 10)] = s.acked
+			}
+			json.NewEncoder(w).Encode(map[string]any{"acks": acks})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *hecServer) counts() (events, ackPolls int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events), s.ackPolls
+}
+
+func newTestSplunkSink(t *testing.T, server *hecServer, cfg splunkSinkConfig) *splunkSink {
+	cfg.URL = server.URL
+	cfg.Token = "secret"
+	cfg.Mode = "event"
+	cfg.Timeout = jsonDuration(2 * time.Second)
+	sink, err := newSplunkSink("splunk", cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.ackPollInterval = 5 * time.Millisecond
+	return sink
+}
+
+func TestSplunkSinkAck(t *testing.T) {
+	server := newHECServer(t)
+	server.acked = true
+	sink := newTestSplunkSink(t, server, splunkSinkConfig{UseAck: true, AckTimeout: jsonDuration(time.Second)})
+	defer sink.Close()
+
+	if err := sink.Send(SystemMetrics{Timestamp: "2026-10-17T06:15:00Z", Hostname: "web01"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, ackPolls := server.counts()
+	if events != 1 || ackPolls != 1 {
+		t.Errorf("%d event requests and %d ack polls, want 1 each", events, ackPolls)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.authHeader != "Splunk secret" || server.channel == "" {
+		t.Errorf("Authorization %q, channel %q", server.authHeader, server.channel)
+	}
+	if !strings.Contains(server.events[0], `"host":"web01"`) || !strings.Contains(server.events[0], `"sourcetype":"_json"`) {
+		t.Errorf("event = %s", server.events[0])
+	}
+}
+
+func TestSplunkSinkAckTimeout(t *testing.T) {
+	server := newHECServer(t)
+	sink := newTestSplunkSink(t, server, splunkSinkConfig{UseAck: true, AckTimeout: jsonDuration(30 * time.Millisecond)})
+	defer sink.Close()
+
+	err := sink.Send(SystemMetrics{Timestamp: "2026-10-17T06:15:00Z", Hostname: "web01"})
+	if err == nil || !strings.Contains(err.Error(), "nicht innerhalb von") {
+		t.Errorf("err = %v, want ack timeout", err)
+	}
+	if _, ackPolls := server.counts(); ackPolls < 2 {
+		t.Errorf("%d ack polls, want polling until the timeout", ackPolls)
+	}
+}
+
+func TestSplunkSinkCloseStopsWaitingForAck(t *testing.T) {
+	server := newHECServer(t)
+	sink := newTestSplunkSink(t, server, splunkSinkConfig{
+		UseAck:        true,
+		AckTimeout:    jsonDuration(time.Minute),
+		BatchSize:     100,
+		FlushInterval: jsonDuration(time.Hour),
+	})
+
+	if err := sink.Send(SystemMetrics{Timestamp: "2026-10-17T06:15:00Z", Hostname: "web01"}); err != nil {
+		t.Fatal(err)
+	}
+	flushed := make(chan error, 1)
+	go func() { flushed <- sink.Flush() }()
+	waitFor(t, 5*time.Second, func() bool { _, ackPolls := server.counts(); return ackPolls > 0 })
+
+	start := time.Now()
+	sink.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took %s while waiting for an ack", elapsed)
+	}
+	if err := <-flushed; err == nil {
+		t.Error("unconfirmed batch reported as delivered")
+	}
+}
+
+func TestSplunkSinkClientError(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusForbidden} {
+		server := newHECServer(t)
+		server.status = status
+		sink := newTestSplunkSink(t, server, splunkSinkConfig{})
+
+		err := sink.Send(SystemMetrics{Timestamp: "2026-10-17T06:15:00Z"})
+		var statusErr *httpStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != status || !strings.Contains(statusErr.Body, "Invalid token") {
+			t.Errorf("HTTP %d: err = %v", status, err)
+		}
+		if events, ackPolls := server.counts(); events != 0 || ackPolls != 0 {
+			t.Errorf("HTTP %d: %d events stored, %d ack polls", status, events, ackPolls)
+		}
+		sink.Close()
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	spoolSegmentExt     = ".clef"
+	spoolSegmentMaxSize = 1024 * 1024 // rotate segments at 1 MB
+)
+
+// spool buffers undelivered events on disk in append-only segment files.
+// Each segment contains newline-delimited CLEF events and is named after a
+// monotonically increasing sequence number, so replay happens in order even
+// across restarts.
+type spool struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	// segmentSize is the size at which a new segment is started. A segment
+	// is always replayed as a whole.
+	segmentSize int64
+
+	mu         sync.Mutex
+	active     *os.File
+	activeSize int64
+	nextSeq    uint64
+}
+
+// spoolConfig holds the spool options of a sink entry in config.json.
+type spoolConfig struct {
+	SpoolDir     string        `json:"spool_dir"`
+	SpoolMaxSize *int          `json:"spool_max_size"` // MB, 0 disables the spool
+	SpoolMaxAge  *jsonDuration `json:"spool_max_age"`
+}
+
+// openSpool opens the spool of the named sink. Without spool_dir every sink gets
+// its own directory below spool next to the executable.
+func (c spoolConfig) openSpool(name string, defaultMaxSizeMB int) (*spool, error) {
+	maxSize := defaultMaxSizeMB
+	if c.SpoolMaxSize != nil {
+		maxSize = *c.SpoolMaxSize
+	}
+	maxAge := 7 * 24 * time.Hour
+	if c.SpoolMaxAge != nil {
+		maxAge = time.Duration(*c.SpoolMaxAge)
+	}
+
+	dir := c.SpoolDir
+	if dir == "" {
+		exeDir, err := executableDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(exeDir, "spool", name)
+	}
+
+	return openSpoolOrNil(dir, maxSize, maxAge), nil
+}
+
+type spoolSegment struct {
+	seq     uint64
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func openSpool(dir string, maxBytes int64, maxAge time.Duration) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &spool{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		nextSeq:  1,
+
+		segmentSize: spoolSegmentMaxSize,
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		s.nextSeq = segments[len(segments)-1].seq + 1
+	}
+
+	return s, nil
+}
+
+// Append writes the given events to the active segment and syncs it to disk.
+func (s *spool) Append(events ...[]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil || s.activeSize >= s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, event := range events {
+		buf.Write(bytes.TrimRight(event, "\n"))
+		buf.WriteByte('\n')
+	}
+
+	n, err := s.active.Write(buf.Bytes())
+	s.activeSize += int64(n)
+	if err != nil {
+		return err
+	}
+	if err := s.active.Sync(); err != nil {
+		return err
+	}
+
+	s.enforceLimits()
+	return nil
+}
+
+// Pending reports whether the spool contains undelivered events.
+func (s *spool) Pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segments, err := s.segments()
+	return err == nil && len(segments) > 0
+}
+
+// Next returns the oldest segment together with its complete lines. If the
+// oldest segment is still being written to, it is closed first so that new
+// events go into a fresh segment while it is replayed.
+func (s *spool) Next() (spoolSegment, []byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enforceLimits()
+
+	segments, err := s.segments()
+	if err != nil || len(segments) == 0 {
+		return spoolSegment{}, nil, false, err
+	}
+
+	oldest := segments[0]
+	if s.active != nil && s.active.Name() == oldest.path {
+		s.closeActive()
+	}
+
+	data, err := os.ReadFile(oldest.path)
+	if err != nil {
+		return oldest, nil, false, err
+	}
+
+	// A crash while appending may leave an incomplete last line behind
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		data = data[:i+1]
+	} else {
+		data = nil
+	}
+
+	return oldest, data, true, nil
+}
+
+// Remove deletes a segment after it has been delivered.
+func (s *spool) Remove(segment spoolSegment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active != nil && s.active.Name() == segment.path {
+		s.closeActive()
+	}
+	return os.Remove(segment.path)
+}
+
+func (s *spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closeActive()
+}
+
+func (s *spool) rotate() error {
+	s.closeActive()
+
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.nextSeq, spoolSegmentExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.nextSeq++
+	s.active = f
+	s.activeSize = 0
+	return nil
+}
+
+func (s *spool) closeActive() error {
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	s.activeSize = 0
+	return err
+}
+
+// enforceLimits drops the oldest segments once the spool exceeds its size or
+// age limit. The active segment is never dropped.
+func (s *spool) enforceLimits() {
+	segments, err := s.segments()
+	if err != nil {
+		return
+	}
+
+	var total int64
+	for _, segment := range segments {
+		total += segment.size
+	}
+
+	for _, segment := range segments {
+		if s.active != nil && s.active.Name() == segment.path {
+			break
+		}
+
+		tooOld := s.maxAge > 0 && time.Since(segment.modTime) > s.maxAge
+		tooLarge := s.maxBytes > 0 && total > s.maxBytes
+		if !tooOld && !tooLarge {
+			break
+		}
+
+		if err := os.Remove(segment.path); err != nil {
+			logError("Fehler beim Verwerfen des Spool-Segments %s: %v", segment.path, err)
+			return
+		}
+		total -= segment.size
+		logError("Spool-Limit erreicht, Segment %s verworfen", filepath.Base(segment.path))
+	}
+}
+
+func (s *spool) segments() ([]spoolSegment, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []spoolSegment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, spoolSegment{
+			seq:     seq,
+			path:    filepath.Join(s.dir, name),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].seq < segments[j].seq
+	})
+
+	return segments, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpoolSegmentRollover(t *testing.T) {
+	sp, err := openSpool(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+	sp.segmentSize = 10
+
+	// Every append of 6 bytes starts a new segment once 10 bytes are written
+	for _, event := range []string{"event1", "event2", "event3", "event4"} {
+		if err := sp.Append([]byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segments, err := sp.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("got %d segments, want 2", len(segments))
+	}
+
+	_, data, ok, err := sp.Next()
+	if err != nil || !ok {
+		t.Fatalf("Next() = %v, %v", ok, err)
+	}
+	if string(data) != "event1\nevent2\n" {
+		t.Errorf("first segment = %q", data)
+	}
+}
+
+func TestSpoolReplayOrderAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	sp, err := openSpool(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp.segmentSize = 1
+	for _, event := range []string{"a", "b", "c"} {
+		if err := sp.Append([]byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sp.Close()
+
+	sp, err = openSpool(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+	sp.segmentSize = 1
+	if err := sp.Append([]byte("d")); err != nil {
+		t.Fatal(err)
+	}
+
+	var replayed []string
+	for {
+		segment, data, ok, err := sp.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		replayed = append(replayed, strings.TrimSuffix(string(data), "\n"))
+		if err := sp.Remove(segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := strings.Join(replayed, ","); got != "a,b,c,d" {
+		t.Errorf("replayed %s, want a,b,c,d", got)
+	}
+	if sp.Pending() {
+		t.Error("spool still pending after replay")
+	}
+}
+
+func TestSpoolSizeLimit(t *testing.T) {
+	sp, err := openSpool(t.TempDir(), 20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+	sp.segmentSize = 1
+
+	// Five segments of 10 bytes each, only the newest two fit into 20 bytes
+	for _, event := range []string{"event0001", "event0002", "event0003", "event0004", "event0005"} {
+		if err := sp.Append([]byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, data, ok, err := sp.Next()
+	if err != nil || !ok {
+		t.Fatalf("Next() = %v, %v", ok, err)
+	}
+	if string(data) != "event0004\n" {
+		t.Errorf("oldest remaining segment = %q, want event0004", data)
+	}
+}
+
+func TestSpoolSizeLimitKeepsActiveSegment(t *testing.T) {
+	sp, err := openSpool(t.TempDir(), 5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+
+	if err := sp.Append([]byte("larger than the limit")); err != nil {
+		t.Fatal(err)
+	}
+	if !sp.Pending() {
+		t.Error("active segment was dropped")
+	}
+}
+
+func TestSpoolAgeLimit(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := openSpool(dir, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+	sp.segmentSize = 1
+
+	for _, event := range []string{"old", "new"} {
+		if err := sp.Append([]byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segments, err := sp.segments()
+	if err != nil || len(segments) != 2 {
+		t.Fatalf("segments() = %d, %v", len(segments), err)
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(segments[0].path, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	_, data, ok, err := sp.Next()
+	if err != nil || !ok {
+		t.Fatalf("Next() = %v, %v", ok, err)
+	}
+	if string(data) != "new\n" {
+		t.Errorf("oldest remaining segment = %q, want new", data)
+	}
+	if _, err := os.Stat(segments[0].path); !os.IsNotExist(err) {
+		t.Errorf("expired segment %s still exists", filepath.Base(segments[0].path))
+	}
+}
+
+func TestSpoolIgnoresIncompleteLastLine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "00000000000000000001"+spoolSegmentExt)
+	if err := os.WriteFile(path, []byte("complete\nincompl"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sp, err := openSpool(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+
+	_, data, ok, err := sp.Next()
+	if err != nil || !ok {
+		t.Fatalf("Next() = %v, %v", ok, err)
+	}
+	if string(data) != "complete\n" {
+		t.Errorf("Next() = %q, want only the complete line", data)
+	}
+}
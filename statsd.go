@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsdSinkConfig is the config.json representation of a StatsD sink.
+type statsdSinkConfig struct {
+	Address       string   `json:"address"`
+	Prefix        string   `json:"prefix"`
+	DogStatsD     bool     `json:"dogstatsd"` // append #host:... tags
+	Tags          []string `json:"tags"`      // additional DogStatsD tags, e.g. "env:prod"
+	MaxPacketSize int      `json:"max_packet_size"`
+}
+
+// statsdSink emits every value of a sample as StatsD gauge over UDP. Lines are
+// packed into as few datagrams as possible without exceeding the packet size.
+type statsdSink struct {
+	cfg  statsdSinkConfig
+	conn net.Conn
+}
+
+func init() {
+	registerSink("statsd", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := statsdSinkConfig{
+			Address:       "localhost:8125",
+			Prefix:        "host_monitor.",
+			MaxPacketSize: 1432, // Ethernet MTU minus IP/UDP headers
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+
+		conn, err := net.DialTimeout("udp", cfg.Address, 10*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return &statsdSink{cfg: cfg, conn: conn}, nil
+	})
+}
+
+func (s *statsdSink) Send(metrics SystemMetrics) error {
+	return writeDatagrams(s.conn, s.lines(metrics), s.cfg.MaxPacketSize)
+}
+
+// writeDatagrams packs newline-separated lines into as few datagrams as
+// possible without exceeding maxSize. A single longer line is sent alone.
+func writeDatagrams(conn net.Conn, lines []string, maxSize int) error {
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxSize {
+			if _, err := conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	if packet.Len() == 0 {
+		return nil
+	}
+	_, err := conn.Write(packet.Bytes())
+	return err
+}
+
+func (s *statsdSink) Flush() error {
+	return nil
+}
+
+func (s *statsdSink) Close() error {
+	return s.conn.Close()
+}
+
+// lines formats a sample as StatsD gauges, e.g.
+// host_monitor.cpu.percent:12.5|g|#host:web01. Values of a core, device,
+// interface or process are tagged with it for DogStatsD, replacing the
+// total of the same name, and contain it in the name otherwise, e.g.
+// host_monitor.disk_io.sda.await_ms.
+func (s *statsdSink) lines(m SystemMetrics) []string {
+	var tags []string
+	if s.cfg.DogStatsD {
+		tags = append([]string{"host:" + statsdTagValue(m.Hostname)}, s.cfg.Tags...)
+	}
+
+	gauge := func(name string, value float64, extraTags ...string) string {
+		line := s.cfg.Prefix + name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|g"
+		if s.cfg.DogStatsD {
+			line += "|#" + strings.Join(append(extraTags, tags...), ",")
+		}
+		return line
+	}
+
+	metrics := flattenMetrics(m)
+	if s.cfg.DogStatsD {
+		metrics = withoutTotals(metrics)
+	}
+
+	var lines []string
+	for _, f := range metrics {
+		switch {
+		case f.dim == "":
+			lines = append(lines, gauge(f.name, f.value))
+		case s.cfg.DogStatsD:
+			lines = append(lines, gauge(f.name, f.value, f.dim+":"+statsdTagValue(f.instance)))
+		default:
+			lines = append(lines, gauge(f.path(graphitePathElement), f.value))
+		}
+	}
+	return lines
+}
+
+// statsdTagValue replaces characters that would break the DogStatsD line format.
+func statsdTagValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '|', '#', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, value)
+}
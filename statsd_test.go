@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsdLines(t *testing.T) {
+	m := SystemMetrics{
+		Hostname:   "web01",
+		CPUPercent: 12.5,
+		CPUCores:   []CPUCoreUsage{{Core: "cpu0", Percent: 50}},
+	}
+
+	tests := []struct {
+		name     string
+		cfg      statsdSinkConfig
+		want     []string
+		unwanted []string
+	}{
+		{
+			name: "statsd",
+			cfg:  statsdSinkConfig{Prefix: "hm."},
+			want: []string{"hm.cpu.percent:12.5|g", "hm.cpu.cpu0.percent:50|g"},
+		},
+		{
+			name: "dogstatsd",
+			cfg:  statsdSinkConfig{Prefix: "hm.", DogStatsD: true, Tags: []string{"env:prod"}},
+			want: []string{"hm.cpu.percent:50|g|#core:cpu0,host:web01,env:prod"},
+			// Summing up the tagged series must not count the total twice
+			unwanted: []string{"hm.cpu.percent:12.5|g|#host:web01,env:prod"},
+		},
+	}
+	for _, tt := range tests {
+		lines := (&statsdSink{cfg: tt.cfg}).lines(m)
+		for _, want := range tt.want {
+			if !slices.Contains(lines, want) {
+				t.Errorf("%s: %q missing in %q", tt.name, want, lines)
+			}
+		}
+		for _, unwanted := range tt.unwanted {
+			if slices.Contains(lines, unwanted) {
+				t.Errorf("%s: unexpected %q", tt.name, unwanted)
+			}
+		}
+	}
+}
+
+func TestStatsdSendSplitsPackets(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("udp", listener.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &statsdSink{cfg: statsdSinkConfig{Prefix: "host_monitor.", MaxPacketSize: 200}, conn: conn}
+	defer s.Close()
+
+	m := SystemMetrics{Hostname: "web01", CPUCores: []CPUCoreUsage{{Core: "cpu0"}, {Core: "cpu1"}}}
+	want := s.lines(m)
+	if err := s.Send(m); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every datagram stays within the limit and contains only whole lines
+	var got []string
+	buf := make([]byte, 65536)
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(got) < len(want) {
+		n, _, err := listener.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("after %d of %d lines: %v", len(got), len(want), err)
+		}
+		if n > 200 {
+			t.Errorf("datagram of %d bytes exceeds max_packet_size", n)
+		}
+		got = append(got, strings.Split(string(buf[:n]), "\n")...)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("received lines\n%q\nwant\n%q", got, want)
+	}
+}
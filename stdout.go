@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// stdoutSink writes samples to the console, either human-readable like the
+// debug mode or as one CLEF/JSON line per sample.
+type stdoutSink struct {
+	json bool
+}
+
+func init() {
+	registerSink("stdout", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		var cfg struct {
+			Format string `json:"format"`
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+
+		switch cfg.Format {
+		case "", "text":
+			return &stdoutSink{}, nil
+		case "json":
+			return &stdoutSink{json: true}, nil
+		default:
+			return nil, fmt.Errorf("unbekanntes Format %q", cfg.Format)
+		}
+	})
+}
+
+func (s *stdoutSink) Send(metrics SystemMetrics) error {
+	if !s.json {
+		printDebugMetrics(metrics)
+		return nil
+	}
+
+	jsonData, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(jsonData))
+	return err
+}
+
+func (s *stdoutSink) Flush() error {
+	return nil
+}
+
+func (s *stdoutSink) Close() error {
+	return nil
+}
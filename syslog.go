@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const syslogSeverityInfo = 6
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSinkConfig is the config.json representation of a syslog sink.
+type syslogSinkConfig struct {
+	Address  string       `json:"address"` // udp://, tcp://, tls:// or unix://
+	Format   string       `json:"format"`  // "sd" or "json"
+	Facility string       `json:"facility"`
+	AppName  string       `json:"app_name"`
+	SDID     string       `json:"sd_id"`
+	Timeout  jsonDuration `json:"timeout"`
+
+	CACert     string `json:"ca_cert"`
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+}
+
+// syslogSink emits every sample as RFC 5424 message, either with the values
+// as structured data or as JSON in the MSG part. TCP and TLS use
+// octet-counting framing (RFC 6587), local stream sockets newline framing,
+// and stream transports reconnect after write errors.
+type syslogSink struct {
+	cfg      syslogSinkConfig
+	network  string
+	address  string
+	framed   bool
+	tls      *tls.Config
+	priority int
+	procID   string
+
+	conn net.Conn
+	// newlineFramed is set when /dev/log only accepts stream connections
+	newlineFramed bool
+}
+
+func init() {
+	registerSink("syslog", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := syslogSinkConfig{
+			Address:  "unix:///dev/log",
+			Format:   "sd",
+			Facility: "daemon",
+			AppName:  "host-monitor",
+			SDID:     "metrics@32473",
+			Timeout:  jsonDuration(10 * time.Second),
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+		return newSyslogSink(cfg)
+	})
+}
+
+func newSyslogSink(cfg syslogSinkConfig) (*syslogSink, error) {
+	facility, ok := syslogFacilities[cfg.Facility]
+	if !ok {
+		return nil, fmt.Errorf("unbekannte Facility %q", cfg.Facility)
+	}
+	if cfg.Format != "sd" && cfg.Format != "json" {
+		return nil, fmt.Errorf("unbekanntes Format %q", cfg.Format)
+	}
+
+	u, err := url.Parse(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &syslogSink{
+		cfg:      cfg,
+		priority: facility*8 + syslogSeverityInfo,
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+
+	switch u.Scheme {
+	case "udp":
+		s.network, s.address = "udp", syslogHostPort(u, "514")
+	case "tcp":
+		s.network, s.address, s.framed = "tcp", syslogHostPort(u, "601"), true
+	case "tls":
+		s.network, s.address, s.framed = "tcp", syslogHostPort(u, "6514"), true
+		s.tls, err = newTLSConfig(cfg.CACert, cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		s.tls.ServerName = u.Hostname()
+	case "unix":
+		s.network, s.address = "unixgram", u.Path
+	default:
+		return nil, fmt.Errorf("nicht unterstütztes Schema %q", u.Scheme)
+	}
+
+	return s, nil
+}
+
+func (s *syslogSink) Send(metrics SystemMetrics) error {
+	msg, err := s.format(metrics)
+	if err != nil {
+		return err
+	}
+
+	// One retry with a fresh connection, e.g. after the collector restarted
+	for attempt := 0; ; attempt++ {
+		if err := s.connect(); err != nil {
+			return err
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(time.Duration(s.cfg.Timeout)))
+		_, err := s.conn.Write([]byte(s.frame(msg)))
+		if err == nil {
+			return nil
+		}
+
+		s.conn.Close()
+		s.conn = nil
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+func (s *syslogSink) Flush() error {
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *syslogSink) connect() error {
+	if s.conn != nil {
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: time.Duration(s.cfg.Timeout)}
+
+	var err error
+	switch {
+	case s.tls != nil:
+		s.conn, err = tls.DialWithDialer(dialer, s.network, s.address, s.tls)
+	case s.network == "unixgram":
+		s.conn, err = dialer.Dial("unixgram", s.address)
+		s.newlineFramed = false
+		if err != nil {
+			// Some systems only provide a stream socket, where messages
+			// are separated by newlines
+			s.conn, err = dialer.Dial("unix", s.address)
+			s.newlineFramed = true
+		}
+	default:
+		s.conn, err = dialer.Dial(s.network, s.address)
+	}
+	return err
+}
+
+// frame delimits a message for stream transports, datagrams are sent as is.
+func (s *syslogSink) frame(msg string) string {
+	switch {
+	case s.framed:
+		return strconv.Itoa(len(msg)) + " " + msg
+	case s.newlineFramed:
+		return msg + "\n"
+	}
+	return msg
+}
+
+// syslogHostPort returns host:port of the URL, using the default port if
+// none is given.
+func syslogHostPort(u *url.URL, defaultPort string) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// format builds an RFC 5424 message:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (s *syslogSink) format(m SystemMetrics) (string, error) {
+	header := fmt.Sprintf("<%d>1 %s %s %s %s %s",
+		s.priority,
+		metricsTime(m).Format(time.RFC3339),
+		syslogHeaderField(m.Hostname),
+		syslogHeaderField(s.cfg.AppName),
+		s.procID,
+		"metrics")
+
+	if s.cfg.Format == "json" {
+		jsonData, err := json.Marshal(m)
+		if err != nil {
+			return "", err
+		}
+		return header + " - " + string(jsonData), nil
+	}
+
+	// An SD-ID may only appear once per message, so there is no element per
+	// core, device, interface or process; those are only in the JSON format
+	var params []string
+	for _, f := range flattenMetrics(m) {
+		if f.dim == "" {
+			params = append(params, syslogParam(strings.ReplaceAll(f.name, ".", "_"), strconv.FormatFloat(f.value, 'f', -1, 64)))
+		}
+	}
+	for _, name := range m.ProcessesNotRunning {
+		params = append(params, syslogParam("process_not_running", name))
+	}
+	for _, name := range m.PortsMissing {
+		params = append(params, syslogParam("port_missing", name))
+	}
+
+	sd := "[" + s.cfg.SDID + " " + strings.Join(params, " ") + "]"
+	return header + " " + sd + " System Metrics from " + m.Hostname, nil
+}
+
+func syslogParam(name, value string) string {
+	return name + `="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value) + `"`
+}
+
+// syslogHeaderField returns a printable header field without spaces, or the
+// NILVALUE if empty.
+func syslogHeaderField(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSyslogSink(t *testing.T, address string) *syslogSink {
+	t.Helper()
+	sink, err := newSyslogSink(syslogSinkConfig{
+		Address:  address,
+		Format:   "sd",
+		Facility: "daemon",
+		AppName:  "host-monitor",
+		SDID:     "metrics@32473",
+		Timeout:  jsonDuration(time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	return sink
+}
+
+func TestSyslogSinkAddress(t *testing.T) {
+	tests := []struct {
+		address, want, serverName string
+	}{
+		{"udp://collector", "collector:514", ""},
+		{"tcp://collector", "collector:601", ""},
+		{"tcp://collector:1514", "collector:1514", ""},
+		{"tls://collector.example.com", "collector.example.com:6514", "collector.example.com"},
+		{"tls://collector.example.com:10514", "collector.example.com:10514", "collector.example.com"},
+		{"tls://[2001:db8::1]", "[2001:db8::1]:6514", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		sink := newTestSyslogSink(t, tt.address)
+		if sink.address != tt.want {
+			t.Errorf("%s: address = %q, want %q", tt.address, sink.address, tt.want)
+		}
+		if sink.tls != nil && sink.tls.ServerName != tt.serverName {
+			t.Errorf("%s: ServerName = %q, want %q", tt.address, sink.tls.ServerName, tt.serverName)
+		}
+	}
+}
+
+func TestSyslogSinkTCPOctetCounting(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sink := newTestSyslogSink(t, "tcp://"+listener.Addr().String())
+	for i := 0; i < 2; i++ {
+		if err := sink.Send(SystemMetrics{Timestamp: "2026-10-17T06:15:00Z", Hostname: "web01"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		prefix, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		length, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+		if err != nil {
+			t.Fatalf("message %d: invalid length prefix %q", i+1, prefix)
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(msg), "<30>1 2026-10-17T06:15:00Z web01 host-monitor ") {
+			t.Errorf("message %d = %q", i+1, msg)
+		}
+	}
+}
+
+func TestSyslogSinkUnixStreamFallback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets not available: %v", err)
+	}
+	defer listener.Close()
+
+	sink := newTestSyslogSink(t, "unix://"+path)
+	for i := 0; i < 2; i++ {
+		if err := sink.Send(SystemMetrics{Timestamp: "2026-10-17T06:15:00Z", Hostname: "web01"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	// Without framing both messages would arrive as one line
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, "<30>1 ") || strings.Count(line, "<30>1 ") != 1 {
+			t.Errorf("message %d = %q", i+1, line)
+		}
+	}
+}
+
+func TestSyslogParamEscaping(t *testing.T) {
+	if got, want := syslogParam("name", `a"b\c]`), `name="a\"b\\c\]"`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestSyslogSDDetailValues(t *testing.T) {
+	sink := newTestSyslogSink(t, "udp://127.0.0.1:514")
+	msg, err := sink.format(SystemMetrics{
+		Hostname: "web01",
+		CPUModes: &CPUModes{User: 12.5},
+		CPUCores: []CPUCoreUsage{{Core: "cpu0", Percent: 50}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(msg, ` cpu_user_percent="12.5" `) {
+		t.Errorf("host-wide detail value missing in %q", msg)
+	}
+	if strings.Contains(msg, "cpu0") {
+		t.Errorf("per-core value in structured data: %q", msg)
+	}
+}
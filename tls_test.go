@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate authority for TLS tests, stored as PEM files in a
+// temporary directory.
+type testCA struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certPath string
+	dir      string
+	serial   int64
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	ca := &testCA{dir: t.TempDir(), serial: 1}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.cert, _ = x509.ParseCertificate(der)
+	ca.key = key
+	ca.certPath = writeTestPEM(t, ca.dir, name+".crt", "CERTIFICATE", der)
+	return ca
+}
+
+// issue creates a certificate for 127.0.0.1 signed by the CA and returns the
+// paths of the certificate and key files.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (certPath, keyPath string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeTestPEM(t, ca.dir, name+".crt", "CERTIFICATE", der),
+		writeTestPEM(t, ca.dir, name+".key", "EC PRIVATE KEY", keyDER)
+}
+
+func writeTestPEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newMutualTLSServer starts an HTTPS server with a certificate of ca that
+// requires a client certificate of the same CA.
+func newMutualTLSServer(t *testing.T, ca *testCA, handler http.Handler) *httptest.Server {
+	t.Helper()
+	certPath, keyPath := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	// Rejected handshakes are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	_, otherKey := ca.issue(t, "other", x509.ExtKeyUsageClientAuth)
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("no certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                          string
+		caCert, clientCert, clientKey string
+		wantErr                       string
+	}{
+		{"CA bundle", ca.certPath, "", "", ""},
+		{"client certificate", "", clientCert, clientKey, ""},
+		{"missing CA file", filepath.Join(ca.dir, "missing.crt"), "", "", "CA-Zertifikat lesen"},
+		{"CA file without certificates", notPEM, "", "", "keine gültigen Zertifikate"},
+		{"certificate without key", "", clientCert, "", "gemeinsam"},
+		{"key without certificate", "", "", clientKey, "gemeinsam"},
+		{"key of another certificate", "", clientCert, otherKey, "Client-Zertifikat laden"},
+		{"missing key file", "", clientCert, filepath.Join(ca.dir, "missing.key"), "Client-Zertifikat laden"},
+	}
+	for _, tt := range tests {
+		tlsConfig, err := newTLSConfig(tt.caCert, tt.clientCert, tt.clientKey)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			} else if (tt.caCert != "" && tlsConfig.RootCAs == nil) || (tt.clientCert != "" && len(tlsConfig.Certificates) != 1) {
+				t.Errorf("%s: config = %+v", tt.name, tlsConfig)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewHTTPClientMutualTLS(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	server := newMutualTLSServer(t, ca, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	unknownCA := newTestCA(t, "unknown")
+
+	tests := []struct {
+		name                          string
+		caCert, clientCert, clientKey string
+		wantErr                       bool
+	}{
+		{"trusted CA with client certificate", ca.certPath, clientCert, clientKey, false},
+		{"unknown CA", unknownCA.certPath, clientCert, clientKey, true},
+		{"system roots only", "", clientCert, clientKey, true},
+		{"without client certificate", ca.certPath, "", "", true},
+	}
+	for _, tt := range tests {
+		client, err := newHTTPClient(tt.caCert, tt.clientCert, tt.clientKey, 2*time.Second)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %t", tt.name, err, tt.wantErr)
+		}
+	}
+}
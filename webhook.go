@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"text/template"
+	"time"
+)
+
+// webhookSinkConfig is the config.json representation of a webhook sink.
+type webhookSinkConfig struct {
+	URL            string            `json:"url"`
+	Method         string            `json:"method"`
+	Headers        map[string]string `json:"headers"`
+	ContentType    string            `json:"content_type"`
+	Template       string            `json:"template"`
+	TemplateFile   string            `json:"template_file"`
+	ExpectedStatus []int             `json:"expected_status"`
+	Timeout        jsonDuration      `json:"timeout"`
+
+	Retry struct {
+		MinBackoff  jsonDuration `json:"min_backoff"`
+		MaxBackoff  jsonDuration `json:"max_backoff"`
+		MaxAttempts int          `json:"max_attempts"`
+	} `json:"retry"`
+
+	spoolConfig
+}
+
+// webhookSink sends every sample to an HTTP endpoint with a body rendered
+// from a text/template. Failed requests are retried through a deliveryQueue
+// like Seq batches.
+type webhookSink struct {
+	cfg      webhookSinkConfig
+	tmpl     *template.Template
+	client   *http.Client
+	expected map[int]bool
+	queue    *deliveryQueue
+}
+
+func init() {
+	registerSink("webhook", func(name string, raw json.RawMessage, config *Config) (Sink, error) {
+		cfg := webhookSinkConfig{
+			Method:      http.MethodPost,
+			ContentType: "application/json",
+			Timeout:     jsonDuration(10 * time.Second),
+		}
+		cfg.Retry.MinBackoff = jsonDuration(1 * time.Second)
+		cfg.Retry.MaxBackoff = jsonDuration(1 * time.Minute)
+		cfg.Retry.MaxAttempts = 3
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+
+		// Unlike Seq the spool is opt-in for webhooks
+		if cfg.SpoolMaxSize == nil {
+			cfg.SpoolMaxSize = new(int)
+		}
+		sp, err := cfg.openSpool(name, 0)
+		if err != nil {
+			return nil, err
+		}
+		if sp != nil {
+			// One payload per segment so a replay never repeats delivered payloads
+			sp.segmentSize = 1
+		}
+
+		return newWebhookSink(name, cfg, sp)
+	})
+}
+
+func newWebhookSink(name string, cfg webhookSinkConfig, sp *spool) (*webhookSink, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("url fehlt")
+	}
+
+	text := cfg.Template
+	if cfg.TemplateFile != "" {
+		data, err := os.ReadFile(cfg.TemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("Template-Datei lesen: %w", err)
+		}
+		text = string(data)
+	}
+	if text == "" {
+		// Default: the sample as CLEF/JSON
+		text = "{{ json . }}"
+	}
+
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Template: %w", err)
+	}
+
+	s := &webhookSink{
+		cfg:      cfg,
+		tmpl:     tmpl,
+		client:   &http.Client{Timeout: time.Duration(cfg.Timeout)},
+		expected: make(map[int]bool),
+	}
+	for _, status := range cfg.ExpectedStatus {
+		s.expected[status] = true
+	}
+
+	s.queue = newDeliveryQueue(name, s.deliver, sp, retryPolicy{
+		MinBackoff:  time.Duration(cfg.Retry.MinBackoff),
+		MaxBackoff:  time.Duration(cfg.Retry.MaxBackoff),
+		MaxAttempts: cfg.Retry.MaxAttempts,
+	})
+
+	return s, nil
+}
+
+func (s *webhookSink) Send(metrics SystemMetrics) error {
+	var body bytes.Buffer
+	if err := s.tmpl.Execute(&body, metrics); err != nil {
+		return fmt.Errorf("Template: %w", err)
+	}
+
+	// Rendered bodies may span several lines, the spool stores one per line
+	record, err := json.Marshal(body.String())
+	if err != nil {
+		return err
+	}
+	return s.queue.Submit(record)
+}
+
+func (s *webhookSink) Flush() error {
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	return s.queue.Close()
+}
+
+func (s *webhookSink) deliver(records [][]byte) error {
+	for _, record := range records {
+		var body string
+		if err := json.Unmarshal(record, &body); err != nil {
+			return err
+		}
+		if err := s.post(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *webhookSink) post(body string) error {
+	req, err := http.NewRequest(s.cfg.Method, s.cfg.URL, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.cfg.ContentType)
+	for key, value := range s.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if len(s.expected) == 0 {
+		err = checkHTTPResponse(resp)
+	} else if !s.expected[resp.StatusCode] {
+		respBody, _ := io.ReadAll(resp.Body)
+		err = &httpStatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	} else {
+		io.Copy(io.Discard, resp.Body)
+	}
+
+	// A client error repeats with the same body, except for timeouts and
+	// rate limits
+	if err != nil && resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentDeliveryError{err: err}
+	}
+	return err
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testWebhookConfig(url string) webhookSinkConfig {
+	cfg := webhookSinkConfig{
+		URL:         url,
+		Method:      http.MethodPost,
+		ContentType: "application/json",
+		Timeout:     jsonDuration(2 * time.Second),
+	}
+	cfg.Retry.MinBackoff = jsonDuration(time.Millisecond)
+	cfg.Retry.MaxBackoff = jsonDuration(5 * time.Millisecond)
+	cfg.Retry.MaxAttempts = 3
+	return cfg
+}
+
+func TestWebhookSinkRendersTemplate(t *testing.T) {
+	server := newRecordingServer(t)
+
+	tests := []struct {
+		name     string
+		template string
+		check    func(body string) bool
+	}{
+		{
+			name:     "template",
+			template: `{"text": "{{ .Hostname }}: CPU {{ printf "%.1f" .CPUPercent }} %"}`,
+			check:    func(body string) bool { return body == `{"text": "web01: CPU 12.5 %"}` },
+		},
+		{
+			name:     "json function",
+			template: `{"host": {{ json .Hostname }}}`,
+			check:    func(body string) bool { return body == `{"host": "web01"}` },
+		},
+		{
+			name: "default CLEF event",
+			check: func(body string) bool {
+				var m SystemMetrics
+				return json.Unmarshal([]byte(body), &m) == nil && m.Hostname == "web01" && m.CPUPercent == 12.5
+			},
+		},
+	}
+	for _, tt := range tests {
+		cfg := testWebhookConfig(server.URL)
+		cfg.Template = tt.template
+		sink, err := newWebhookSink("webhook", cfg, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := sink.Send(SystemMetrics{Hostname: "web01", CPUPercent: 12.5}); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		sink.Close()
+
+		received := server.received()
+		if len(received) == 0 || !tt.check(received[len(received)-1]) {
+			t.Errorf("%s: received %q", tt.name, received)
+		}
+	}
+}
+
+func TestNewWebhookSinkTemplateFile(t *testing.T) {
+	server := newRecordingServer(t)
+	path := filepath.Join(t.TempDir(), "body.tmpl")
+	if err := os.WriteFile(path, []byte("{{ .Hostname }}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// template_file takes precedence over template
+	cfg := testWebhookConfig(server.URL)
+	cfg.Template = "ignored"
+	cfg.TemplateFile = path
+	sink, err := newWebhookSink("webhook", cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.Send(SystemMetrics{Hostname: "web01"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.received(); !slices.Equal(got, []string{"web01\n"}) {
+		t.Errorf("received %q", got)
+	}
+
+	cfg.TemplateFile = filepath.Join(t.TempDir(), "missing.tmpl")
+	if _, err := newWebhookSink("webhook", cfg, nil); err == nil || !strings.Contains(err.Error(), "Template-Datei") {
+		t.Errorf("missing template file: err = %v", err)
+	}
+
+	cfg.TemplateFile = ""
+	cfg.Template = "{{ .Hostname"
+	if _, err := newWebhookSink("webhook", cfg, nil); err == nil {
+		t.Error("no error for invalid template")
+	}
+}
+
+func TestWebhookSinkRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		expected []int
+		attempts int32
+		fails    bool
+	}{
+		{"success", http.StatusNoContent, nil, 1, false},
+		{"server error", http.StatusServiceUnavailable, nil, 3, true},
+		{"rate limited", http.StatusTooManyRequests, nil, 3, true},
+		{"not found", http.StatusNotFound, nil, 1, true},
+		{"unauthorized", http.StatusUnauthorized, nil, 1, true},
+		{"expected status", http.StatusCreated, []int{201}, 1, false},
+		{"success outside expected status", http.StatusOK, []int{201}, 3, true},
+		{"client error in expected status", http.StatusConflict, []int{201, 409}, 1, false},
+	}
+	for _, tt := range tests {
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(tt.status)
+		}))
+
+		cfg := testWebhookConfig(server.URL)
+		cfg.ExpectedStatus = tt.expected
+		sink, err := newWebhookSink("webhook", cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sink.Send(SystemMetrics{Hostname: "web01"})
+		sink.Close()
+		server.Close()
+
+		if (err != nil) != tt.fails {
+			t.Errorf("%s: err = %v, want failure %t", tt.name, err, tt.fails)
+		}
+		if got := attempts.Load(); got != tt.attempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, got, tt.attempts)
+		}
+	}
+}
+
+func TestWebhookSinkReplaysSpoolAfterRecovery(t *testing.T) {
+	server := newRecordingServer(t)
+	server.setStatus(http.StatusServiceUnavailable)
+
+	sp, err := openSpool(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp.segmentSize = 1
+
+	cfg := testWebhookConfig(server.URL)
+	cfg.Template = "{{ .Hostname }}\n{{ .CPUPercent }}"
+	cfg.Retry.MaxAttempts = 0 // keep replaying until the endpoint recovers
+	sink, err := newWebhookSink("webhook", cfg, sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	for _, cpu := range []float64{1, 2} {
+		if err := sink.Send(SystemMetrics{Hostname: "web01", CPUPercent: cpu}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !sp.Pending() {
+		t.Fatal("payloads not spooled while the endpoint is down")
+	}
+
+	server.setStatus(http.StatusOK)
+	waitFor(t, 5*time.Second, func() bool { return !sp.Pending() })
+
+	// Each payload is replayed once as its own request, newlines included
+	if got := server.received(); !slices.Equal(got, []string{"web01\n1", "web01\n2"}) {
+		t.Errorf("received %q", got)
+	}
+}